@@ -0,0 +1,546 @@
+// Command enaml-gen generates the enaml-gen property structs of a job from a
+// BOSH release tarball.
+//
+//	go run haproxy/cmd/enaml-gen/main.go \
+//		-release haproxy/.cache/haproxy-boshrelease?v=8.0.9 \
+//		-job haproxy -out haproxy/enaml-gen/haproxy
+//
+// It reads jobs/<job>.tgz from the release, parses the properties of its
+// job.MF and writes one file per struct, named after the struct. Fields are
+// sorted so regenerating from the same release gives the same files.
+//
+// Field types are inferred from each property's default, falling back to its
+// example. Lists of hashes become slices of a struct named after the
+// property. Properties the spec can not type, because they have neither or
+// the example is wrong, are typed with -type, e.g.
+//
+//	-type ha_proxy.ssl_pem=[]string
+//
+// and anything left untyped stays interface{}.
+//
+// Alongside the structs it records the job's property names and consumed
+// links under the release version in JobSpecs, so a binary built against
+// the newest release's structs can tell what an older release supports.
+// Give -structs=false to only record the spec of an older release.
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+type jobSpec struct {
+	Name       string              `yaml:"name"`
+	Properties map[string]property `yaml:"properties"`
+	Consumes   []struct {
+		Name string `yaml:"name"`
+	} `yaml:"consumes"`
+}
+
+type releaseManifest struct {
+	Version string `yaml:"version"`
+}
+
+type property struct {
+	Description string      `yaml:"description"`
+	Default     interface{} `yaml:"default"`
+	Example     interface{} `yaml:"example"`
+}
+
+type structType struct {
+	Name   string
+	Fields map[string]*field
+	// Record structs are inferred from the hashes in a list, so their
+	// fields have no description or default.
+	Record bool
+}
+
+type field struct {
+	Key         string
+	Name        string
+	Description string
+	Default     interface{}
+	Type        string
+	Struct      *structType
+}
+
+// typeOverrides maps property names to the go type to give them. A type
+// ending in a list of fields, e.g. map[string]Backend{port:int,servers:[]string},
+// declares a record struct of that name for it.
+type typeOverrides map[string]string
+
+func (t typeOverrides) String() string {
+	return fmt.Sprint(map[string]string(t))
+}
+
+func (t typeOverrides) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("type '%s' should be property=gotype", value)
+	}
+	t[parts[0]] = parts[1]
+	return nil
+}
+
+func main() {
+	release := flag.String("release", "", "path to the release tarball")
+	job := flag.String("job", "", "name of the job in the release")
+	out := flag.String("out", "", "directory to write the generated files to")
+	pkg := flag.String("package", "", "package name of the generated files, defaults to the job name")
+	types := make(typeOverrides)
+	flag.Var(types, "type", "property=gotype to type a property the spec can not, can be repeated")
+	structs := flag.Bool("structs", true, "generate the property structs, not only the job spec")
+	flag.Parse()
+
+	if *release == "" || *job == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *pkg == "" {
+		*pkg = strings.ToLower(camelCase(*job))
+	}
+	if err := generate(*release, *job, *out, *pkg, types, *structs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func generate(release, job, out, pkg string, overrides typeOverrides, structs bool) error {
+	b, err := readReleaseEntry(release, "release.MF")
+	if err != nil {
+		return err
+	}
+	manifest := new(releaseManifest)
+	if err = yaml.Unmarshal(b, manifest); err != nil || manifest.Version == "" {
+		return fmt.Errorf("invalid release manifest in release @ '%v': %v", release, err)
+	}
+	if b, err = readJobSpec(release, job); err != nil {
+		return err
+	}
+	spec := new(jobSpec)
+	if err = yaml.Unmarshal(b, spec); err != nil {
+		return fmt.Errorf("invalid job spec for '%s' in release @ '%v': %v", job, release, err)
+	}
+	if err = os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		"jobspec.go": jobSpecsSource(pkg),
+		"jobspec_" + strings.NewReplacer(".", "_", "-", "_").Replace(manifest.Version) + ".go": spec.source(pkg, manifest.Version),
+	}
+	if structs {
+		if err = addStructFiles(files, spec, job, pkg, overrides); err != nil {
+			return err
+		}
+	}
+	for name, source := range files {
+		filename := filepath.Join(out, name)
+		if err = ioutil.WriteFile(filename, source, 0644); err != nil {
+			return fmt.Errorf("cant write '%v': %v", filename, err)
+		}
+	}
+	return nil
+}
+
+func addStructFiles(files map[string][]byte, spec *jobSpec, job, pkg string, overrides typeOverrides) error {
+	for key := range overrides {
+		if _, ok := spec.Properties[key]; !ok {
+			return fmt.Errorf("type given for unknown property '%s'", key)
+		}
+	}
+	types, err := newStructTypes(camelCase(job)+"Job", spec.Properties, overrides)
+	if err != nil {
+		return err
+	}
+	for _, t := range types {
+		files[strings.ToLower(t.Name)+".go"] = t.source(pkg)
+	}
+	return nil
+}
+
+// readReleaseEntry returns the contents of the named file in a release
+// tarball.
+func readReleaseEntry(release, name string) ([]byte, error) {
+	f, err := os.Open(release)
+	if err != nil {
+		return nil, fmt.Errorf("cant read release @ '%v': %v", release, err)
+	}
+	defer f.Close()
+	b, err := readTarEntry(f, name)
+	if err != nil {
+		return nil, fmt.Errorf("cant read %s in release @ '%v': %v", name, release, err)
+	}
+	return b, nil
+}
+
+// readJobSpec returns the job.MF of jobs/<job>.tgz in a release tarball.
+func readJobSpec(release, job string) ([]byte, error) {
+	jobTarball, err := readReleaseEntry(release, path.Join("jobs", job+".tgz"))
+	if err != nil {
+		return nil, err
+	}
+	spec, err := readTarEntry(bytes.NewReader(jobTarball), "job.MF")
+	if err != nil {
+		return nil, fmt.Errorf("cant read job spec of '%s' in release @ '%v': %v", job, release, err)
+	}
+	return spec, nil
+}
+
+// readTarEntry returns the contents of the named file in a gzipped tarball.
+func readTarEntry(r io.Reader, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Clean(hdr.Name) == name {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
+
+// newStructTypes turns the dotted property names of a job spec into a tree
+// of structs, starting from the job struct. Groups with the same name share
+// a struct.
+func newStructTypes(jobType string, properties map[string]property, overrides typeOverrides) ([]*structType, error) {
+	root := &structType{Name: jobType, Fields: make(map[string]*field)}
+	types := map[string]*structType{jobType: root}
+	for key, prop := range properties {
+		parts := strings.Split(key, ".")
+		current := root
+		for i, part := range parts {
+			f, ok := current.Fields[part]
+			if i == len(parts)-1 {
+				if ok {
+					return nil, fmt.Errorf("property '%s' is both a value and a group of properties", key)
+				}
+				goType, ok := overrides[key]
+				if ok && strings.HasSuffix(goType, "}") {
+					var err error
+					if goType, err = newOverrideRecord(goType, types); err != nil {
+						return nil, fmt.Errorf("invalid type for property '%s': %v", key, err)
+					}
+				}
+				if !ok {
+					var err error
+					if goType, err = inferType(part, prop, types); err != nil {
+						return nil, fmt.Errorf("cant infer the type of property '%s': %v", key, err)
+					}
+				}
+				current.Fields[part] = &field{
+					Key:         part,
+					Name:        camelCase(part),
+					Description: prop.Description,
+					Default:     prop.Default,
+					Type:        goType,
+				}
+				break
+			}
+			if ok && f.Struct == nil {
+				return nil, fmt.Errorf("property '%s' is both a value and a group of properties", strings.Join(parts[:i+1], "."))
+			}
+			if !ok {
+				name := camelCase(part)
+				t, exists := types[name]
+				if !exists {
+					t = &structType{Name: name, Fields: make(map[string]*field)}
+					types[name] = t
+				}
+				f = &field{
+					Key:         part,
+					Name:        name,
+					Description: strings.Join(parts[:i+1], ".") + " properties",
+					Struct:      t,
+				}
+				current.Fields[part] = f
+			}
+			current = f.Struct
+		}
+	}
+	var names []string
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sorted []*structType
+	for _, name := range names {
+		sorted = append(sorted, types[name])
+	}
+	return sorted, nil
+}
+
+// source renders the struct the way the enaml generator does.
+func (t *structType) source(pkg string) []byte {
+	var keys []string
+	for key := range t.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s \n", pkg)
+	buf.WriteString(generatedHeader)
+	fmt.Fprintf(&buf, "type %s struct {\n", t.Name)
+	for _, key := range keys {
+		f := t.Fields[key]
+		if t.Record {
+			fmt.Fprintf(&buf, "\t%s %s `yaml:\"%s,omitempty\"`\n", f.Name, f.Type, f.Key)
+			continue
+		}
+		if f.Struct != nil {
+			fmt.Fprintf(&buf, "\n\t/*%s - Descr: %s\n*/\n", f.Name, f.Description)
+			fmt.Fprintf(&buf, "\t%s *%s `yaml:\"%s,omitempty\"`\n", f.Name, f.Struct.Name, f.Key)
+			continue
+		}
+		fmt.Fprintf(&buf, "\n\t/*%s - Descr: %s Default: %v\n*/\n", f.Name, f.Description, f.Default)
+		fmt.Fprintf(&buf, "\t%s %s `yaml:\"%s,omitempty\"`\n", f.Name, f.Type, f.Key)
+	}
+	if t.Record {
+		buf.WriteString("}")
+		return buf.Bytes()
+	}
+	buf.WriteString("\n}")
+	return buf.Bytes()
+}
+
+const generatedHeader = "/*\n* File Generated by enaml generator\n* !!! Please do not edit this file !!!\n*/\n"
+
+// jobSpecsSource declares JobSpecs, which each generated release adds its
+// job spec to.
+func jobSpecsSource(pkg string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s \n", pkg)
+	buf.WriteString(generatedHeader)
+	buf.WriteString("type JobSpec struct {\n\tProperties []string\n\tConsumes []string\n}\n\n")
+	buf.WriteString("/*JobSpecs - the job spec of each release generated into this package, by release version\n*/\n")
+	buf.WriteString("var JobSpecs = map[string]JobSpec{}")
+	return buf.Bytes()
+}
+
+// source renders the property names and consumed links of the job in a
+// release.
+func (spec *jobSpec) source(pkg, version string) []byte {
+	var properties, consumes []string
+	for key := range spec.Properties {
+		properties = append(properties, key)
+	}
+	sort.Strings(properties)
+	for _, link := range spec.Consumes {
+		consumes = append(consumes, link.Name)
+	}
+	sort.Strings(consumes)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s \n", pkg)
+	buf.WriteString(generatedHeader)
+	buf.WriteString("func init() {\n")
+	fmt.Fprintf(&buf, "\tJobSpecs[%q] = JobSpec{\n", version)
+	buf.WriteString("\t\tProperties: []string{\n")
+	for _, p := range properties {
+		fmt.Fprintf(&buf, "\t\t\t%q,\n", p)
+	}
+	buf.WriteString("\t\t},\n\t\tConsumes: []string{\n")
+	for _, c := range consumes {
+		fmt.Fprintf(&buf, "\t\t\t%q,\n", c)
+	}
+	buf.WriteString("\t\t},\n\t}\n}")
+	return buf.Bytes()
+}
+
+// inferType returns the go type of a property from its default, or from its
+// example when the default is empty.
+func inferType(name string, prop property, types map[string]*structType) (string, error) {
+	if goType, err := typeOf(name, prop.Default, types); err != nil || goType != "" {
+		return goType, err
+	}
+	example := prop.Example
+	if s, ok := example.(string); ok {
+		// examples are often a yaml snippet rather than a value
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(s), &parsed); err == nil {
+			example = parsed
+		}
+	}
+	if m, ok := example.(map[interface{}]interface{}); ok && len(m) == 1 {
+		// and are often keyed by the property name
+		if value, ok := m[name]; ok {
+			example = value
+		}
+	}
+	if goType, err := typeOf(name, example, types); err != nil || goType != "" {
+		return goType, err
+	}
+	if _, ok := prop.Default.([]interface{}); ok {
+		return "[]string", nil
+	}
+	return "interface{}", nil
+}
+
+// typeOf returns the go type of a yaml value, or "" when the value is empty
+// and so says nothing about its type. Lists of hashes become a slice of a
+// record struct named after the property.
+func typeOf(name string, value interface{}, types map[string]*structType) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return "string", nil
+	case bool:
+		return "bool", nil
+	case int:
+		return "int", nil
+	case float64:
+		return "float64", nil
+	case []interface{}:
+		if len(v) == 0 {
+			return "", nil
+		}
+		if isRecords(v) {
+			t, err := newRecord(name, v, types)
+			if err != nil {
+				return "", err
+			}
+			return "[]" + t.Name, nil
+		}
+		elem, err := commonType(name, v, types)
+		if elem == "" || err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	case map[interface{}]interface{}:
+		var values []interface{}
+		for _, value := range v {
+			values = append(values, value)
+		}
+		elem, err := commonType(name, values, types)
+		if elem == "" || err != nil {
+			return "", err
+		}
+		return "map[string]" + elem, nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// commonType returns the type shared by values. Mixed scalars are strings,
+// as they are all rendered into the job's templates as text.
+func commonType(name string, values []interface{}, types map[string]*structType) (string, error) {
+	common := ""
+	for _, value := range values {
+		goType, err := typeOf(name, value, types)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case goType == "" || goType == common:
+		case common == "":
+			common = goType
+		case isScalar(common) && isScalar(goType):
+			common = "string"
+		default:
+			return "", fmt.Errorf("values of both %s and %s", common, goType)
+		}
+	}
+	return common, nil
+}
+
+func isScalar(goType string) bool {
+	switch goType {
+	case "string", "bool", "int", "float64":
+		return true
+	}
+	return false
+}
+
+func isRecords(values []interface{}) bool {
+	for _, value := range values {
+		if _, ok := value.(map[interface{}]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecord adds a struct with a field for every key of the hashes in
+// records.
+func newRecord(name string, records []interface{}, types map[string]*structType) (*structType, error) {
+	t := &structType{Name: camelCase(name), Fields: make(map[string]*field), Record: true}
+	if _, exists := types[t.Name]; exists {
+		return nil, fmt.Errorf("a struct named %s already exists", t.Name)
+	}
+	values := make(map[string][]interface{})
+	for _, record := range records {
+		for key, value := range record.(map[interface{}]interface{}) {
+			values[fmt.Sprint(key)] = append(values[fmt.Sprint(key)], value)
+		}
+	}
+	for key, keyValues := range values {
+		goType, err := commonType(key, keyValues, types)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		if goType == "" {
+			goType = "interface{}"
+		}
+		t.Fields[key] = &field{Key: key, Name: camelCase(key), Type: goType}
+	}
+	types[t.Name] = t
+	return t, nil
+}
+
+// newOverrideRecord adds the record struct declared by a type override like
+// map[string]Backend{port:int,servers:[]string}, and returns the type
+// without its fields.
+func newOverrideRecord(goType string, types map[string]*structType) (string, error) {
+	open := strings.Index(goType, "{")
+	if open < 0 {
+		return "", fmt.Errorf("'%s' has no opening {", goType)
+	}
+	outer := goType[:open]
+	name := strings.TrimPrefix(strings.TrimPrefix(outer, "[]"), "map[string]")
+	if name == "" || name != camelCase(name) {
+		return "", fmt.Errorf("'%s' should name an exported record struct", outer)
+	}
+	t := &structType{Name: name, Fields: make(map[string]*field), Record: true}
+	if _, exists := types[t.Name]; exists {
+		return "", fmt.Errorf("a struct named %s already exists", t.Name)
+	}
+	for _, def := range strings.Split(goType[open+1:len(goType)-1], ",") {
+		parts := strings.SplitN(def, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return "", fmt.Errorf("record field '%s' should be key:gotype", def)
+		}
+		t.Fields[parts[0]] = &field{Key: parts[0], Name: camelCase(parts[0]), Type: parts[1]}
+	}
+	types[t.Name] = t
+	return outer, nil
+}
+
+// camelCase turns a snake or kebab case name into an exported Go name.
+func camelCase(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' })
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	return strings.Join(parts, "")
+}
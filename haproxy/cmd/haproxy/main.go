@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/enaml-ops/haproxy-plugin/haproxy/plugin"
 	"github.com/enaml-ops/pluginlib/productv1"
 )
@@ -9,7 +12,15 @@ import (
 var Version string = "v0.0.0" // overridden at link time
 
 func main() {
-	product.Run(&haproxy_plugin.Plugin{
+	p := &haproxy_plugin.Plugin{
 		Version: Version,
-	})
+	}
+	if len(os.Args) > 1 && os.Args[1] == haproxy_plugin.CertReportCommand {
+		if err := p.GetCertReport(os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	product.Run(p)
 }
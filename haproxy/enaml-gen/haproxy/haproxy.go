@@ -5,136 +5,136 @@ package haproxy
 */
 type HaProxy struct {
 
-	/*LogLevel - Descr: Log level Default: info
+	/*AcceptProxy - Descr: Allow accept proxy Default: false
 */
-	LogLevel interface{} `yaml:"log_level,omitempty"`
+	AcceptProxy bool `yaml:"accept_proxy,omitempty"`
 
-	/*RequestTimeout - Descr: Maximum HTTP request length (in seconds) Default: 30
+	/*BackendPort - Descr: Listening port for Router Default: 80
 */
-	RequestTimeout interface{} `yaml:"request_timeout,omitempty"`
+	BackendPort int `yaml:"backend_port,omitempty"`
 
-	/*SslCiphers - Descr: List of SSL Ciphers that are passed to HAProxy Default: ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-AES256-GCM-SHA384:DHE-RSA-AES128-GCM-SHA256:DHE-DSS-AES128-GCM-SHA256:kEDH+AESGCM:ECDHE-RSA-AES128-SHA256:ECDHE-ECDSA-AES128-SHA256:ECDHE-RSA-AES128-SHA:ECDHE-ECDSA-AES128-SHA:ECDHE-RSA-AES256-SHA384:ECDHE-ECDSA-AES256-SHA384:ECDHE-RSA-AES256-SHA:ECDHE-ECDSA-AES256-SHA:DHE-RSA-AES128-SHA256:DHE-RSA-AES128-SHA:DHE-DSS-AES128-SHA256:DHE-RSA-AES256-SHA256:DHE-DSS-AES256-SHA:DHE-RSA-AES256-SHA:AES128-GCM-SHA256:AES256-GCM-SHA384:ECDHE-RSA-RC4-SHA:ECDHE-ECDSA-RC4-SHA:AES128:AES256:RC4-SHA:HIGH:!aNULL:!eNULL:!EXPORT:!DES:!3DES:!MD5:!PSK
+	/*BackendServers - Descr: Array of the router IPs acting as the HTTP/TCP backends (should include servers all Availability Zones being used) Default: []
 */
-	SslCiphers interface{} `yaml:"ssl_ciphers,omitempty"`
+	BackendServers []string `yaml:"backend_servers,omitempty"`
 
-	/*KeepaliveTimeout - Descr: Timeout waiting for new HTTP requests under http keep-alive mode (in seconds) Default: 1
+	/*ClientTimeout - Descr: Timeout waiting for data from a client (in seconds) Default: 30
 */
-	KeepaliveTimeout interface{} `yaml:"keepalive_timeout,omitempty"`
+	ClientTimeout int `yaml:"client_timeout,omitempty"`
 
-	/*Enable4443 - Descr: Enables port 4443 for backwards compatibility with WSS-based apps using the old CF haproxy Default: false
+	/*CompressTypes - Descr: If this property is set, gzip compression will be activated for the mime types named in this property. definition like 'text/html text/plain text/css' Default: 
 */
-	Enable4443 interface{} `yaml:"enable_4443,omitempty"`
+	CompressTypes string `yaml:"compress_types,omitempty"`
 
-	/*WebsocketTimeout - Descr: Timeout for websocket/tunnel traffic (in seconds) Default: 3600
+	/*ConnectTimeout - Descr: Timeout waiting for connections to establish to a server (in seconds) Default: 5
 */
-	WebsocketTimeout interface{} `yaml:"websocket_timeout,omitempty"`
+	ConnectTimeout int `yaml:"connect_timeout,omitempty"`
 
-	/*Headers - Descr: Hash of custom headers you wish you have set on each request. Spaces are automatically escaped, but any other haproxy delimiters will need to be escaped manually Default: <nil>
+	/*DefaultDhParam - Descr: Maximum size of DH params when generating epmehmeral keys during key exchange Default: 2048
 */
-	Headers interface{} `yaml:"headers,omitempty"`
+	DefaultDhParam int `yaml:"default_dh_param,omitempty"`
 
-	/*ServerTimeout - Descr: Timeout waiting for data from a server (in seconds) Default: 30
+	/*DisableHttp - Descr: Disable port 80 traffic Default: false
 */
-	ServerTimeout interface{} `yaml:"server_timeout,omitempty"`
+	DisableHttp bool `yaml:"disable_http,omitempty"`
 
-	/*StatsPassword - Descr: Password to authenticate haproxy stats Default: <nil>
+	/*DnsHold - Descr: DNS Hold time Default: 10s
 */
-	StatsPassword interface{} `yaml:"stats_password,omitempty"`
+	DnsHold string `yaml:"dns_hold,omitempty"`
 
-	/*Resolvers - Descr: List of DNS servers Default: <nil>
+	/*Enable4443 - Descr: Enables port 4443 for backwards compatibility with WSS-based apps using the old CF haproxy Default: false
 */
-	Resolvers interface{} `yaml:"resolvers,omitempty"`
+	Enable4443 bool `yaml:"enable_4443,omitempty"`
 
-	/*BackendServers - Descr: Array of the router IPs acting as the HTTP/TCP backends (should include servers all Availability Zones being used) Default: []
+	/*Headers - Descr: Hash of custom headers you wish you have set on each request. Spaces are automatically escaped, but any other haproxy delimiters will need to be escaped manually Default: <nil>
 */
-	BackendServers interface{} `yaml:"backend_servers,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
 
-	/*HttpsRedirectDomains - Descr: For each domain in this array, a HTTPS redirect rule will be put in the config file. Redirect will be applied for all subdomains Default: []
+	/*HttpsRedirectAll - Descr: If this is set to 'true', a https redirect rule for all http calls will be put in the config file Default: false
 */
-	HttpsRedirectDomains interface{} `yaml:"https_redirect_domains,omitempty"`
+	HttpsRedirectAll bool `yaml:"https_redirect_all,omitempty"`
 
-	/*StatsUri - Descr: URI used to access the stats UI. Default: haproxy_stats
+	/*HttpsRedirectDomains - Descr: For each domain in this array, a HTTPS redirect rule will be put in the config file. Redirect will be applied for all subdomains Default: []
 */
-	StatsUri interface{} `yaml:"stats_uri,omitempty"`
+	HttpsRedirectDomains []string `yaml:"https_redirect_domains,omitempty"`
 
-	/*DnsHold - Descr: DNS Hold time Default: 10s
+	/*InternalOnlyDomains - Descr: Array of domains for internal-only apps/services (not hostnames for the apps/services) Default: []
 */
-	DnsHold interface{} `yaml:"dns_hold,omitempty"`
+	InternalOnlyDomains []string `yaml:"internal_only_domains,omitempty"`
 
-	/*AcceptProxy - Descr: Allow accept proxy Default: false
+	/*KeepaliveTimeout - Descr: Timeout waiting for new HTTP requests under http keep-alive mode (in seconds) Default: 1
 */
-	AcceptProxy interface{} `yaml:"accept_proxy,omitempty"`
+	KeepaliveTimeout int `yaml:"keepalive_timeout,omitempty"`
 
-	/*SslPem - Descr: SSL certificate (PEM file), or an array of SSL certificates (PEM files) Default: <nil>
+	/*LogLevel - Descr: Log level Default: info
 */
-	SslPem interface{} `yaml:"ssl_pem,omitempty"`
+	LogLevel string `yaml:"log_level,omitempty"`
 
-	/*DisableHttp - Descr: Disable port 80 traffic Default: false
+	/*QueueTimeout - Descr: Timeout for requests queued waiting for free connection slots (in seconds) Default: 30
 */
-	DisableHttp interface{} `yaml:"disable_http,omitempty"`
+	QueueTimeout int `yaml:"queue_timeout,omitempty"`
 
-	/*RoutedBackendServers - Descr: Hash of the URL prefixes -> array of the router IPs acting as the HTTP/TCP backends (should include servers all Availability Zones being used) Default: map[]
+	/*RequestTimeout - Descr: Maximum HTTP request length (in seconds) Default: 30
 */
-	RoutedBackendServers interface{} `yaml:"routed_backend_servers,omitempty"`
+	RequestTimeout int `yaml:"request_timeout,omitempty"`
 
-	/*DefaultDhParam - Descr: Maximum size of DH params when generating epmehmeral keys during key exchange Default: 2048
+	/*Resolvers - Descr: List of DNS servers Default: <nil>
 */
-	DefaultDhParam interface{} `yaml:"default_dh_param,omitempty"`
+	Resolvers []map[string]string `yaml:"resolvers,omitempty"`
 
-	/*HttpsRedirectAll - Descr: If this is set to 'true', a https redirect rule for all http calls will be put in the config file Default: false
+	/*RoutedBackendServers - Descr: Hash of the URL prefixes -> array of the router IPs acting as the HTTP/TCP backends (should include servers all Availability Zones being used) Default: map[]
 */
-	HttpsRedirectAll interface{} `yaml:"https_redirect_all,omitempty"`
+	RoutedBackendServers map[string]RoutedBackendServer `yaml:"routed_backend_servers,omitempty"`
 
-	/*QueueTimeout - Descr: Timeout for requests queued waiting for free connection slots (in seconds) Default: 30
+	/*RspHeaders - Descr: Hash of custom headers you wish you have set on each request. Spaces are automatically escaped, but any other haproxy delimiters will need to be escaped manually Default: <nil>
 */
-	QueueTimeout interface{} `yaml:"queue_timeout,omitempty"`
+	RspHeaders map[string]string `yaml:"rsp_headers,omitempty"`
 
-	/*StatsUser - Descr: User name to authenticate haproxy stats Default: <nil>
+	/*ServerTimeout - Descr: Timeout waiting for data from a server (in seconds) Default: 30
 */
-	StatsUser interface{} `yaml:"stats_user,omitempty"`
+	ServerTimeout int `yaml:"server_timeout,omitempty"`
 
-	/*SyslogServer - Descr: An IPv4 address optionally followed by a colon and a UDP port. It can also be an IPv6 address or filesystem path to a UNIX domain socket. Default: 127.0.0.1
+	/*SslCiphers - Descr: List of SSL Ciphers that are passed to HAProxy Default: ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-AES256-GCM-SHA384:DHE-RSA-AES128-GCM-SHA256:DHE-DSS-AES128-GCM-SHA256:kEDH+AESGCM:ECDHE-RSA-AES128-SHA256:ECDHE-ECDSA-AES128-SHA256:ECDHE-RSA-AES128-SHA:ECDHE-ECDSA-AES128-SHA:ECDHE-RSA-AES256-SHA384:ECDHE-ECDSA-AES256-SHA384:ECDHE-RSA-AES256-SHA:ECDHE-ECDSA-AES256-SHA:DHE-RSA-AES128-SHA256:DHE-RSA-AES128-SHA:DHE-DSS-AES128-SHA256:DHE-RSA-AES256-SHA256:DHE-DSS-AES256-SHA:DHE-RSA-AES256-SHA:AES128-GCM-SHA256:AES256-GCM-SHA384:ECDHE-RSA-RC4-SHA:ECDHE-ECDSA-RC4-SHA:AES128:AES256:RC4-SHA:HIGH:!aNULL:!eNULL:!EXPORT:!DES:!3DES:!MD5:!PSK
 */
-	SyslogServer interface{} `yaml:"syslog_server,omitempty"`
+	SslCiphers string `yaml:"ssl_ciphers,omitempty"`
 
-	/*StatsEnable - Descr: If true, haproxy will enable a socket for stats. You can see the stats on haproxy_ip:9000/haproxy_stats Default: false
+	/*SslPem - Descr: SSL certificate (PEM file), or an array of SSL certificates (PEM files) Default: <nil>
 */
-	StatsEnable interface{} `yaml:"stats_enable,omitempty"`
+	SslPem []string `yaml:"ssl_pem,omitempty"`
 
-	/*TrustedDomainCidrs - Descr: Space separated trusted cidr blocks for internal_only_domains Default: 0.0.0.0/32
+	/*StatsEnable - Descr: If true, haproxy will enable a socket for stats. You can see the stats on haproxy_ip:9000/haproxy_stats Default: false
 */
-	TrustedDomainCidrs interface{} `yaml:"trusted_domain_cidrs,omitempty"`
+	StatsEnable bool `yaml:"stats_enable,omitempty"`
 
-	/*InternalOnlyDomains - Descr: Array of domains for internal-only apps/services (not hostnames for the apps/services) Default: []
+	/*StatsPassword - Descr: Password to authenticate haproxy stats Default: <nil>
 */
-	InternalOnlyDomains interface{} `yaml:"internal_only_domains,omitempty"`
+	StatsPassword string `yaml:"stats_password,omitempty"`
 
-	/*ConnectTimeout - Descr: Timeout waiting for connections to establish to a server (in seconds) Default: 5
+	/*StatsUri - Descr: URI used to access the stats UI. Default: haproxy_stats
 */
-	ConnectTimeout interface{} `yaml:"connect_timeout,omitempty"`
+	StatsUri string `yaml:"stats_uri,omitempty"`
 
-	/*ClientTimeout - Descr: Timeout waiting for data from a client (in seconds) Default: 30
+	/*StatsUser - Descr: User name to authenticate haproxy stats Default: <nil>
 */
-	ClientTimeout interface{} `yaml:"client_timeout,omitempty"`
+	StatsUser string `yaml:"stats_user,omitempty"`
 
-	/*RspHeaders - Descr: Hash of custom headers you wish you have set on each request. Spaces are automatically escaped, but any other haproxy delimiters will need to be escaped manually Default: <nil>
+	/*SyslogServer - Descr: An IPv4 address optionally followed by a colon and a UDP port. It can also be an IPv6 address or filesystem path to a UNIX domain socket. Default: 127.0.0.1
 */
-	RspHeaders interface{} `yaml:"rsp_headers,omitempty"`
+	SyslogServer string `yaml:"syslog_server,omitempty"`
 
-	/*TrustedStatsCidrs - Descr: Trusted ip range that can access the stats UI Default: 0.0.0.0/32
+	/*Tcp - Descr: List of mappings to perform tcp-based proxying on. See example for mapping datastructure and keys Default: []
 */
-	TrustedStatsCidrs interface{} `yaml:"trusted_stats_cidrs,omitempty"`
+	Tcp []Tcp `yaml:"tcp,omitempty"`
 
-	/*BackendPort - Descr: Listening port for Router Default: 80
+	/*TrustedDomainCidrs - Descr: Space separated trusted cidr blocks for internal_only_domains Default: 0.0.0.0/32
 */
-	BackendPort interface{} `yaml:"backend_port,omitempty"`
+	TrustedDomainCidrs string `yaml:"trusted_domain_cidrs,omitempty"`
 
-	/*CompressTypes - Descr: If this property is set, gzip compression will be activated for the mime types named in this property. definition like 'text/html text/plain text/css' Default: 
+	/*TrustedStatsCidrs - Descr: Trusted ip range that can access the stats UI Default: 0.0.0.0/32
 */
-	CompressTypes interface{} `yaml:"compress_types,omitempty"`
+	TrustedStatsCidrs string `yaml:"trusted_stats_cidrs,omitempty"`
 
-	/*Tcp - Descr: List of mappings to perform tcp-based proxying on. See example for mapping datastructure and keys Default: []
+	/*WebsocketTimeout - Descr: Timeout for websocket/tunnel traffic (in seconds) Default: 3600
 */
-	Tcp interface{} `yaml:"tcp,omitempty"`
+	WebsocketTimeout int `yaml:"websocket_timeout,omitempty"`
 
 }
\ No newline at end of file
@@ -5,7 +5,7 @@ package haproxy
 */
 type HaproxyJob struct {
 
-	/*HaProxy - Descr: DNS Hold time Default: 10s
+	/*HaProxy - Descr: ha_proxy properties
 */
 	HaProxy *HaProxy `yaml:"ha_proxy,omitempty"`
 
@@ -0,0 +1,13 @@
+package haproxy 
+/*
+* File Generated by enaml generator
+* !!! Please do not edit this file !!!
+*/
+type JobSpec struct {
+	Properties []string
+	Consumes []string
+}
+
+/*JobSpecs - the job spec of each release generated into this package, by release version
+*/
+var JobSpecs = map[string]JobSpec{}
\ No newline at end of file
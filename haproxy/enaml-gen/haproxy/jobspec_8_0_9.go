@@ -0,0 +1,46 @@
+package haproxy 
+/*
+* File Generated by enaml generator
+* !!! Please do not edit this file !!!
+*/
+func init() {
+	JobSpecs["8.0.9"] = JobSpec{
+		Properties: []string{
+			"ha_proxy.accept_proxy",
+			"ha_proxy.backend_port",
+			"ha_proxy.backend_servers",
+			"ha_proxy.client_timeout",
+			"ha_proxy.compress_types",
+			"ha_proxy.connect_timeout",
+			"ha_proxy.default_dh_param",
+			"ha_proxy.disable_http",
+			"ha_proxy.dns_hold",
+			"ha_proxy.enable_4443",
+			"ha_proxy.headers",
+			"ha_proxy.https_redirect_all",
+			"ha_proxy.https_redirect_domains",
+			"ha_proxy.internal_only_domains",
+			"ha_proxy.keepalive_timeout",
+			"ha_proxy.log_level",
+			"ha_proxy.queue_timeout",
+			"ha_proxy.request_timeout",
+			"ha_proxy.resolvers",
+			"ha_proxy.routed_backend_servers",
+			"ha_proxy.rsp_headers",
+			"ha_proxy.server_timeout",
+			"ha_proxy.ssl_ciphers",
+			"ha_proxy.ssl_pem",
+			"ha_proxy.stats_enable",
+			"ha_proxy.stats_password",
+			"ha_proxy.stats_uri",
+			"ha_proxy.stats_user",
+			"ha_proxy.syslog_server",
+			"ha_proxy.tcp",
+			"ha_proxy.trusted_domain_cidrs",
+			"ha_proxy.trusted_stats_cidrs",
+			"ha_proxy.websocket_timeout",
+		},
+		Consumes: []string{
+		},
+	}
+}
\ No newline at end of file
@@ -0,0 +1,9 @@
+package haproxy 
+/*
+* File Generated by enaml generator
+* !!! Please do not edit this file !!!
+*/
+type RoutedBackendServer struct {
+	Port int `yaml:"port,omitempty"`
+	Servers []string `yaml:"servers,omitempty"`
+}
\ No newline at end of file
@@ -0,0 +1,12 @@
+package haproxy 
+/*
+* File Generated by enaml generator
+* !!! Please do not edit this file !!!
+*/
+type Tcp struct {
+	BackendPort int `yaml:"backend_port,omitempty"`
+	BackendServers []string `yaml:"backend_servers,omitempty"`
+	Name string `yaml:"name,omitempty"`
+	Port int `yaml:"port,omitempty"`
+	Ssl bool `yaml:"ssl,omitempty"`
+}
\ No newline at end of file
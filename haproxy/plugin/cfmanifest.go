@@ -0,0 +1,70 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/enaml-ops/enaml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const gorouterJobName = "gorouter"
+
+// loadGoRouterIPs fills the gorouter ips from the static ips of every
+// gorouter instance group in a Cloud Foundry deployment manifest, such as
+// one per az, after checking exactly one source of gorouters was given.
+func (p *Plugin) loadGoRouterIPs() error {
+	sources := 0
+	for _, given := range []bool{len(p.GoRouterIPs) > 0, p.CFManifest != "", p.GoRouterLink != ""} {
+		if given {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("give exactly one of gorouter-ip, cf-manifest or gorouter-link")
+	}
+	if p.CFManifest == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(p.CFManifest)
+	if err != nil {
+		return fmt.Errorf("cant read cf manifest @ '%v': %v", p.CFManifest, err)
+	}
+	manifest := new(enaml.DeploymentManifest)
+	if err = yaml.Unmarshal(b, manifest); err != nil {
+		return fmt.Errorf("cant parse cf manifest @ '%v': %v", p.CFManifest, err)
+	}
+	var ips []string
+	for _, ig := range manifest.InstanceGroups {
+		if ig.GetJobByName(gorouterJobName) == nil {
+			continue
+		}
+		groupIPs, err := p.instanceGroupStaticIPs(ig)
+		if err != nil {
+			return err
+		}
+		ips = append(ips, groupIPs...)
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("no instance group with a %s job in cf manifest @ '%v'", gorouterJobName, p.CFManifest)
+	}
+	p.GoRouterIPs = ips
+	return nil
+}
+
+// instanceGroupStaticIPs returns the static ips of a cf manifest instance
+// group on network-name.
+func (p *Plugin) instanceGroupStaticIPs(ig *enaml.InstanceGroup) ([]string, error) {
+	var networkNames []string
+	for _, network := range ig.Networks {
+		if network.Name != p.NetworkName {
+			networkNames = append(networkNames, network.Name)
+			continue
+		}
+		if len(network.StaticIPs) == 0 {
+			return nil, fmt.Errorf("instance group '%s' in cf manifest @ '%v' has no static ips on network '%s'", ig.Name, p.CFManifest, p.NetworkName)
+		}
+		return network.StaticIPs, nil
+	}
+	return nil, fmt.Errorf("instance group '%s' in cf manifest @ '%v' is on networks %v, not network-name '%s'", ig.Name, p.CFManifest, networkNames, p.NetworkName)
+}
@@ -0,0 +1,306 @@
+package haproxy_plugin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/xchapter7x/lo"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type cloudConfig struct {
+	AZs      []cloudConfigNamed   `yaml:"azs"`
+	VMTypes  []cloudConfigNamed   `yaml:"vm_types"`
+	Networks []cloudConfigNetwork `yaml:"networks"`
+}
+
+type cloudConfigNamed struct {
+	Name string `yaml:"name"`
+}
+
+type cloudConfigNetwork struct {
+	Name    string              `yaml:"name"`
+	Type    string              `yaml:"type"`
+	Subnets []cloudConfigSubnet `yaml:"subnets"`
+}
+
+type cloudConfigSubnet struct {
+	AZ     string   `yaml:"az"`
+	AZs    []string `yaml:"azs"`
+	Static []string `yaml:"static"`
+}
+
+// parseCloudConfig returns nil when no cloud config is given.
+func parseCloudConfig(b []byte) (*cloudConfig, error) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, nil
+	}
+	cc := new(cloudConfig)
+	if err := yaml.Unmarshal(b, cc); err != nil {
+		return nil, fmt.Errorf("invalid cloud config: %v", err)
+	}
+	return cc, nil
+}
+
+func (cc *cloudConfig) network(name string) *cloudConfigNetwork {
+	for i := range cc.Networks {
+		if cc.Networks[i].Name == name {
+			return &cc.Networks[i]
+		}
+	}
+	return nil
+}
+
+func (cc *cloudConfig) networkNames() []string {
+	var names []string
+	for _, network := range cc.Networks {
+		names = append(names, network.Name)
+	}
+	return names
+}
+
+// validateCloudConfig checks the vm type, network, azs and haproxy ips
+// against the director's cloud config, so typos are caught before BOSH
+// tries to deploy. It is skipped when no cloud config is given.
+func (p *Plugin) validateCloudConfig(cc *cloudConfig) error {
+	if cc == nil {
+		return nil
+	}
+	if err := checkName("vm-type", p.VMType, namesOf(cc.VMTypes)); err != nil {
+		return err
+	}
+	for _, az := range p.AZs {
+		if err := checkName("az", az, namesOf(cc.AZs)); err != nil {
+			return err
+		}
+	}
+	if err := checkName("network-name", p.NetworkName, cc.networkNames()); err != nil {
+		return err
+	}
+	return p.checkStaticIPs(cc.network(p.NetworkName))
+}
+
+// allocateHaProxyIPs picks free addresses from the static ranges of the
+// network's subnets in the deployment's azs, skipping the gorouter ips and
+// the keepalived vip. It takes one address from each subnet in turn, so the
+// instances are spread across the azs rather than all landing in the first.
+func (p *Plugin) allocateHaProxyIPs(cc *cloudConfig) error {
+	if cc == nil {
+		return fmt.Errorf("haproxy-ip is required when no cloud config is available to allocate ips from")
+	}
+	network := cc.network(p.NetworkName)
+	if network == nil {
+		return checkName("network-name", p.NetworkName, cc.networkNames())
+	}
+	count := p.HaProxyInstances
+	if count == 0 {
+		count = 1
+	}
+	taken := make(map[string]bool)
+	for _, ip := range p.GoRouterIPs {
+		taken[ip] = true
+	}
+	taken[p.KeepalivedVIP] = true
+
+	var free [][]string
+	for _, subnet := range network.Subnets {
+		if !p.inAZs(subnet) {
+			continue
+		}
+		subnetIPs, err := freeStaticIPs(subnet, taken, count)
+		if err != nil {
+			return fmt.Errorf("invalid static range in network '%s': %v", network.Name, err)
+		}
+		free = append(free, subnetIPs)
+	}
+	var ips []string
+	for i := 0; i < count && len(ips) < count; i++ {
+		for _, subnetIPs := range free {
+			if i < len(subnetIPs) && len(ips) < count && !taken[subnetIPs[i]] {
+				ips = append(ips, subnetIPs[i])
+				taken[subnetIPs[i]] = true
+			}
+		}
+	}
+	if len(ips) < count {
+		return fmt.Errorf("only found %d of %d free static ips in network '%s' for azs %v", len(ips), count, network.Name, p.AZs)
+	}
+	lo.G.Infof("allocated haproxy ips %s, update DNS to point at them", strings.Join(ips, ", "))
+	p.HaProxyIPs = ips
+	return nil
+}
+
+// freeStaticIPs returns up to max addresses from the static ranges of a
+// subnet that are not taken.
+func freeStaticIPs(subnet cloudConfigSubnet, taken map[string]bool, max int) ([]string, error) {
+	var ips []string
+	for _, entry := range subnet.Static {
+		first, last, err := parseStaticRange(entry)
+		if err != nil {
+			return nil, err
+		}
+		for ip := first; bytes.Compare(ip, last) <= 0 && len(ips) < max; ip = nextIP(ip) {
+			if !taken[ip.String()] {
+				ips = append(ips, ip.String())
+			}
+		}
+	}
+	return ips, nil
+}
+
+// checkStaticIPs makes sure every haproxy ip falls inside a static range of
+// a subnet of the network that is in one of the deployment's azs.
+func (p *Plugin) checkStaticIPs(network *cloudConfigNetwork) error {
+	if len(network.Subnets) == 0 {
+		return nil
+	}
+	for _, ip := range p.HaProxyIPs {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return fmt.Errorf("haproxy-ip '%s' is not a valid ip", ip)
+		}
+		found := false
+		for _, subnet := range network.Subnets {
+			if !p.inAZs(subnet) {
+				continue
+			}
+			in, err := inStaticRanges(parsed, subnet.Static)
+			if err != nil {
+				return fmt.Errorf("invalid static range in network '%s': %v", network.Name, err)
+			}
+			if in {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("haproxy-ip '%s' is not in a static range of network '%s' for azs %v", ip, network.Name, p.AZs)
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) inAZs(subnet cloudConfigSubnet) bool {
+	subnetAZs := subnet.AZs
+	if subnet.AZ != "" {
+		subnetAZs = append(subnetAZs, subnet.AZ)
+	}
+	if len(subnetAZs) == 0 {
+		return true
+	}
+	for _, az := range subnetAZs {
+		for _, want := range p.AZs {
+			if az == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inStaticRanges reports whether ip is in any of the static entries.
+func inStaticRanges(ip net.IP, static []string) (bool, error) {
+	for _, entry := range static {
+		first, last, err := parseStaticRange(entry)
+		if err != nil {
+			return false, err
+		}
+		if bytes.Compare(ip.To16(), first) >= 0 && bytes.Compare(ip.To16(), last) <= 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseStaticRange parses a static entry, which is either a single ip or a
+// range written as "10.0.0.10 - 10.0.0.20".
+func parseStaticRange(entry string) (net.IP, net.IP, error) {
+	bounds := strings.Split(entry, "-")
+	first := net.ParseIP(strings.TrimSpace(bounds[0]))
+	last := first
+	if len(bounds) == 2 {
+		last = net.ParseIP(strings.TrimSpace(bounds[1]))
+	}
+	if first == nil || last == nil || len(bounds) > 2 {
+		return nil, nil, fmt.Errorf("'%s' is not an ip or ip range", entry)
+	}
+	return first.To16(), last.To16(), nil
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func namesOf(named []cloudConfigNamed) []string {
+	var names []string
+	for _, n := range named {
+		names = append(names, n.Name)
+	}
+	return names
+}
+
+func checkName(flag, name string, known []string) error {
+	for _, k := range known {
+		if k == name {
+			return nil
+		}
+	}
+	msg := fmt.Sprintf("%s '%s' is not in the cloud config", flag, name)
+	if suggestion := closest(name, known); suggestion != "" {
+		msg += fmt.Sprintf(", did you mean '%s'?", suggestion)
+	}
+	return errors.New(msg)
+}
+
+// closest returns the known name nearest to name, or "" when nothing is
+// close enough to be a likely typo.
+func closest(name string, known []string) string {
+	best, bestDistance := "", len(name)/2+1
+	for _, k := range known {
+		if d := levenshtein(name, k); d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,47 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// compressTextPreset is given as --compress-type to compress the common
+// text based content types.
+const compressTextPreset = "text"
+
+var compressTextTypes = []string{
+	"text/html",
+	"text/plain",
+	"text/css",
+	"text/xml",
+	"text/javascript",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// newCompressTypes expands the text preset, validates each mime type and
+// joins them in the space separated form the release expects.
+func (p *Plugin) newCompressTypes() (string, error) {
+	var types []string
+	seen := make(map[string]bool)
+	for _, t := range p.CompressTypes {
+		expanded := []string{t}
+		if t == compressTextPreset {
+			expanded = compressTextTypes
+		}
+		for _, e := range expanded {
+			mediaType, params, err := mime.ParseMediaType(e)
+			if err != nil || len(params) > 0 || strings.Count(mediaType, "/") != 1 {
+				return "", fmt.Errorf("compress-type '%s' is not a valid mime type", e)
+			}
+			if !seen[mediaType] {
+				seen[mediaType] = true
+				types = append(types, mediaType)
+			}
+		}
+	}
+	return strings.Join(types, " "), nil
+}
@@ -0,0 +1,127 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/enaml-ops/pluginlib/pcli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const configFlagName = "config"
+
+// withConfigFile merges the values of a --config file into args. The file is
+// YAML (or JSON, which is valid YAML) keyed by flag name. Values are only
+// used for flags that were not given on the command line or through an
+// OMG_* environment variable, so the precedence is:
+//
+//	command line flags > OMG_* environment variables > config file > defaults
+func withConfigFile(args []string, flags []pcli.Flag) ([]string, error) {
+	configPath := findConfigPath(args)
+	if configPath == "" {
+		return args, nil
+	}
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("cant read config file @ '%v': %v", configPath, err)
+	}
+	config := make(map[string]interface{})
+	if err = yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid config file @ '%v': %v", configPath, err)
+	}
+
+	flagTypes := make(map[string]pcli.FlagType)
+	for _, f := range flags {
+		flagTypes[f.Name] = f.FlagType
+	}
+	merged := append([]string{}, args...)
+	for name, value := range config {
+		flagType, ok := flagTypes[name]
+		if !ok || name == configFlagName {
+			return nil, fmt.Errorf("unknown key '%v' in config file @ '%v'", name, configPath)
+		}
+		if hasFlag(args, name) || os.Getenv(makeEnvVarName(name)) != "" {
+			continue
+		}
+		configArgs, err := configValueToArgs(name, flagType, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for '%v' in config file @ '%v': %v", name, configPath, err)
+		}
+		merged = append(merged, configArgs...)
+	}
+	return merged, nil
+}
+
+func configValueToArgs(name string, flagType pcli.FlagType, value interface{}) ([]string, error) {
+	flag := "--" + name
+	switch flagType {
+	case pcli.StringSliceFlag:
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		var args []string
+		for _, v := range values {
+			s, err := configScalar(v)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, flag, s)
+		}
+		return args, nil
+	case pcli.BoolFlag, pcli.BoolTFlag:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected true or false, got %v", value)
+		}
+		return []string{fmt.Sprintf("%s=%t", flag, b)}, nil
+	default:
+		s, err := configScalar(value)
+		if err != nil {
+			return nil, err
+		}
+		return []string{flag, s}, nil
+	}
+}
+
+func configScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string, int, float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("expected a single value, got %v", value)
+	}
+}
+
+// findConfigPath returns the --config flag's value, falling back to the
+// OMG_CONFIG environment variable like any other flag.
+func findConfigPath(args []string) string {
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == configFlagName && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, configFlagName+"=") {
+			return strings.TrimPrefix(name, configFlagName+"=")
+		}
+	}
+	return os.Getenv(makeEnvVarName(configFlagName))
+}
+
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		arg = strings.TrimLeft(arg, "-")
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
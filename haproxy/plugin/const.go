@@ -1,15 +1,37 @@
 package haproxy_plugin
 
 const (
-	releaseName                 = "haproxy"
-	releaseVersion              = "latest"
-	defaultDeploymentName       = "haproxy"
-	defaultStemcellName         = "ubuntu-trusty"
-	defaultStemcellAlias        = "trusty"
-	defaultStemcellVersion      = "3232.17"
-	DefaultInstanceGroupName    = "external-haproxy"
-	DefaultJobName              = "haproxy"
-	DefaultHaProxyInstanceCount = 1
-	DefaultReleaseURL           = "https://bosh.io/d/github.com/cloudfoundry-community/haproxy-boshrelease?v=8.0.9"
-	DefaultReleaseSHA           = "13598c70a50f8caf95d06782d67610daede8aeb9"
+	releaseName              = "haproxy"
+	defaultDeploymentName    = "haproxy"
+	defaultStemcellName      = "ubuntu-trusty"
+	defaultStemcellAlias     = "trusty"
+	defaultStemcellVersion   = "3232.17"
+	DefaultInstanceGroupName = "external-haproxy"
+	DefaultJobName           = "haproxy"
+	DefaultReleaseVersion    = "8.0.9"
+	DefaultReleaseURL        = "https://bosh.io/d/github.com/cloudfoundry-community/haproxy-boshrelease?v=8.0.9"
+	DefaultReleaseSHA        = "13598c70a50f8caf95d06782d67610daede8aeb9"
+
+	keepalivedReleaseName            = "keepalived"
+	keepalivedReleaseVersion         = "latest"
+	keepalivedPasswordKey            = "keepalived-password"
+	keepalivedBasePriority           = 100
+	defaultKeepalivedInterface       = "eth0"
+	defaultKeepalivedVirtualRouterID = "1"
+	DefaultKeepalivedJobName         = "keepalived"
+
+	defaultExpiryWindowDays = "30"
+
+	defaultTLSProfile = "intermediate"
+	defaultDhParam    = 2048
+
+	statsPasswordKey = "haproxy-stats-password"
+	defaultStatsUser = "haproxy_stats"
+	defaultStatsURI  = "haproxy_stats"
+	statsPort        = 9000
+
+	sslCAVariableName              = "haproxy_ca"
+	sslCertVariableName            = "haproxy_ssl"
+	statsPasswordVariableName      = "haproxy_stats_password"
+	keepalivedPasswordVariableName = "keepalived_password"
 )
@@ -0,0 +1,66 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	hostnamePattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.?$`)
+	numericPattern  = regexp.MustCompile(`^[0-9]+$`)
+	// haproxy time values are a number with an optional unit
+	haproxyTimePattern = regexp.MustCompile(`^[0-9]+(us|ms|s|m|h|d)?$`)
+)
+
+// validateBackendServers checks each gorouter is an ip or a hostname, and
+// that hostnames can be resolved through at least one dns resolver.
+func (p *Plugin) validateBackendServers() error {
+	usesHostname := false
+	for _, server := range p.GoRouterIPs {
+		if net.ParseIP(server) != nil {
+			continue
+		}
+		if !isHostname(server) {
+			return fmt.Errorf("gorouter-ip '%s' is neither an ip nor a hostname", server)
+		}
+		usesHostname = true
+	}
+	if usesHostname && len(p.DNSResolvers) == 0 {
+		return fmt.Errorf("at least one dns-resolver is required when a gorouter-ip is a hostname")
+	}
+	if p.DNSHold != "" && !haproxyTimePattern.MatchString(p.DNSHold) {
+		return fmt.Errorf("dns-hold '%s' should be a number with an optional unit (us, ms, s, m, h or d)", p.DNSHold)
+	}
+	return nil
+}
+
+// isHostname reports whether s is a valid hostname. A numeric last label is
+// rejected, so a mistyped ip such as 10.0.0.256 is not taken for a name.
+func isHostname(s string) bool {
+	if len(s) > 253 || !hostnamePattern.MatchString(s) {
+		return false
+	}
+	labels := strings.Split(strings.TrimSuffix(s, "."), ".")
+	return !numericPattern.MatchString(labels[len(labels)-1])
+}
+
+// newResolvers returns the dns resolvers in the release's list of
+// name -> address form, naming them in the order they were given. The
+// release appends :53 to each address, so a port can not be given, and an
+// ipv6 address would run into the port.
+func (p *Plugin) newResolvers() ([]map[string]string, error) {
+	var resolvers []map[string]string
+	for i, resolver := range p.DNSResolvers {
+		ip := net.ParseIP(resolver)
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("dns-resolver '%s' should be an ipv4 address, the haproxy release always queries port 53", resolver)
+		}
+		resolvers = append(resolvers, map[string]string{
+			"dns" + strconv.Itoa(i): resolver,
+		})
+	}
+	return resolvers, nil
+}
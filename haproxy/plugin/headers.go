@@ -0,0 +1,102 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// headersFile is the format of --headers-file.
+type headersFile struct {
+	Request  map[string]string `yaml:"request"`
+	Response map[string]string `yaml:"response"`
+}
+
+// haproxyEscaper escapes the haproxy config delimiters the release does not
+// escape itself, in both header names and values. The release already
+// escapes spaces, but haproxy also splits arguments on tabs, so they are
+// written as haproxy's \t escape.
+var haproxyEscaper = strings.NewReplacer(`\`, `\\`, `#`, `\#`, `"`, `\"`, `'`, `\'`, "\t", `\t`)
+
+// newHeaders returns the request and response headers from the headers file
+// and flags, with flags taking precedence over the file.
+func (p *Plugin) newHeaders() (request, response map[string]string, err error) {
+	request = make(map[string]string)
+	response = make(map[string]string)
+	if p.HeadersFile != "" {
+		b, err := ioutil.ReadFile(p.HeadersFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cant read headers file @ '%v': %v", p.HeadersFile, err)
+		}
+		f := new(headersFile)
+		if err = yaml.Unmarshal(b, f); err != nil {
+			return nil, nil, fmt.Errorf("invalid headers file @ '%v': %v", p.HeadersFile, err)
+		}
+		for name, value := range f.Request {
+			if err = addHeader(request, name, value); err != nil {
+				return nil, nil, err
+			}
+		}
+		for name, value := range f.Response {
+			if err = addHeader(response, name, value); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if err = addHeaderFlags(request, p.RequestHeaders); err != nil {
+		return nil, nil, err
+	}
+	if err = addHeaderFlags(response, p.ResponseHeaders); err != nil {
+		return nil, nil, err
+	}
+	return request, response, nil
+}
+
+func addHeaderFlags(headers map[string]string, flags []string) error {
+	for _, h := range flags {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("header '%s' should be 'Name: value'", h)
+		}
+		if err := addHeader(headers, parts[0], strings.TrimSpace(parts[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addHeader(headers map[string]string, name, value string) error {
+	if err := validateHeaderName(name); err != nil {
+		return err
+	}
+	for _, r := range value {
+		if (r < ' ' && r != '\t') || r == 0x7f {
+			return fmt.Errorf("header '%s' value contains a control character", name)
+		}
+	}
+	headers[haproxyEscaper.Replace(name)] = haproxyEscaper.Replace(value)
+	return nil
+}
+
+// validateHeaderName checks name is a token as defined by RFC 7230.
+func validateHeaderName(name string) error {
+	if name == "" {
+		return fmt.Errorf("header name is empty")
+	}
+	for _, r := range name {
+		if !isTokenChar(r) {
+			return fmt.Errorf("header name '%s' contains invalid character %q", name, r)
+		}
+	}
+	return nil
+}
+
+func isTokenChar(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
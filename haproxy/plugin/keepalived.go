@@ -0,0 +1,103 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xchapter7x/lo"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// KeepalivedJob is the properties of the keepalived job colocated with
+// haproxy.
+//
+// Unlike the haproxy bindings these are not generated, as no keepalived
+// release is pinned to generate them from. The property names are checked
+// against the keepalived job spec when a keepalived-release-tarball is
+// given, since bosh silently ignores properties a job does not declare.
+type KeepalivedJob struct {
+	Keepalived *Keepalived `yaml:"keepalived,omitempty"`
+}
+
+// Keepalived is the keepalived property group of the keepalived job.
+type Keepalived struct {
+	// VirtualIP is the virtual ip address shared by the instances.
+	VirtualIP string `yaml:"virtual_ip,omitempty"`
+
+	// Interface is the network interface the virtual ip is bound to.
+	Interface string `yaml:"interface,omitempty"`
+
+	// VirtualRouterID is the vrrp virtual router id (1-255), which must be
+	// unique per network segment.
+	VirtualRouterID int `yaml:"virtual_router_id,omitempty"`
+
+	// Password is used to authenticate vrrp advertisements.
+	Password string `yaml:"password,omitempty"`
+
+	// Priorities maps each instance ip to its vrrp priority; the instance
+	// with the highest priority holds the virtual ip.
+	Priorities map[string]int `yaml:"priorities,omitempty"`
+}
+
+// loadKeepalivedTarball takes the keepalived release name, version and sha
+// from a local release tarball, the same way loadReleaseTarball does for
+// haproxy, along with the properties its keepalived job declares.
+func (p *Plugin) loadKeepalivedTarball() error {
+	if p.KeepalivedReleaseTarball == "" {
+		return nil
+	}
+	if !p.keepalivedEnabled() {
+		return fmt.Errorf("keepalived-release-tarball can only be given with keepalived-vip")
+	}
+	release, err := readReleaseTarball("keepalived-release-tarball", p.KeepalivedReleaseTarball, DefaultKeepalivedJobName)
+	if err != nil {
+		return err
+	}
+	if p.KeepalivedReleaseSHA != "" && !strings.EqualFold(p.KeepalivedReleaseSHA, release.SHA1) {
+		return fmt.Errorf("keepalived-release-sha %s does not match the sha %s of keepalived-release-tarball @ '%v'", p.KeepalivedReleaseSHA, release.SHA1, p.KeepalivedReleaseTarball)
+	}
+	if p.KeepalivedReleaseVer != "" && p.KeepalivedReleaseVer != keepalivedReleaseVersion && p.KeepalivedReleaseVer != release.Version {
+		return fmt.Errorf("keepalived-release-ver %s does not match the version %s of keepalived-release-tarball @ '%v'", p.KeepalivedReleaseVer, release.Version, p.KeepalivedReleaseTarball)
+	}
+	p.keepalivedReleaseName = release.Name
+	p.KeepalivedReleaseVer = release.Version
+	p.KeepalivedReleaseSHA = release.SHA1
+	if p.KeepalivedReleaseURL == "" {
+		p.KeepalivedReleaseURL = release.URL
+	}
+	p.keepalivedJobSpec = release.Spec.jobSpec()
+	return nil
+}
+
+// validateKeepalivedRelease rejects keepalived properties the keepalived
+// job does not declare, which bosh would otherwise drop without a word.
+func (p *Plugin) validateKeepalivedRelease() error {
+	if p.keepalivedJobSpec == nil {
+		lo.G.Warningf("no keepalived-release-tarball given, the keepalived properties are not checked against the keepalived job spec")
+		return nil
+	}
+	supported := make(map[string]bool)
+	for _, property := range p.keepalivedJobSpec.Properties {
+		supported[property] = true
+	}
+	b, err := yaml.Marshal(p.newKeepalived())
+	if err != nil {
+		return err
+	}
+	properties := make(map[string]interface{})
+	if err = yaml.Unmarshal(b, &properties); err != nil {
+		return err
+	}
+	var keys []string
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !supported["keepalived."+key] {
+			return fmt.Errorf("the keepalived job of keepalived release %s does not declare keepalived.%s", p.KeepalivedReleaseVer, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package haproxy_plugin
+
+import "fmt"
+
+// gorouterLinkName is the link the haproxy job consumes its http backends
+// through.
+const gorouterLinkName = "http_backend"
+
+// validateGoRouterLink only lets gorouter-link through when the selected
+// release's haproxy job is known to consume the link, which no release in
+// the catalog does yet, so it needs the job spec of a release-tarball.
+func (p *Plugin) validateGoRouterLink() error {
+	if p.GoRouterLinkDeployment != "" && p.GoRouterLink == "" {
+		return fmt.Errorf("gorouter-link-deployment is only used with gorouter-link")
+	}
+	if p.GoRouterLink == "" {
+		return nil
+	}
+	if p.jobSpec == nil {
+		return fmt.Errorf("cant tell whether haproxy release %s consumes a %s link, give its release-tarball to use gorouter-link", p.HaproxyReleaseVer, gorouterLinkName)
+	}
+	for _, consumed := range p.jobSpec.Consumes {
+		if consumed == gorouterLinkName {
+			return nil
+		}
+	}
+	return fmt.Errorf("haproxy release %s does not support gorouter-link, its haproxy job does not consume a %s link", p.HaproxyReleaseVer, gorouterLinkName)
+}
+
+// newConsumes returns the links the haproxy job consumes, letting BOSH
+// provide the gorouter addresses so haproxy follows router scaling.
+func (p *Plugin) newConsumes() map[string]interface{} {
+	if p.GoRouterLink == "" {
+		return nil
+	}
+	link := map[string]interface{}{
+		"from": p.GoRouterLink,
+	}
+	if p.GoRouterLinkDeployment != "" {
+		link["deployment"] = p.GoRouterLinkDeployment
+	}
+	return map[string]interface{}{
+		gorouterLinkName: link,
+	}
+}
@@ -0,0 +1,79 @@
+package haproxy_plugin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// validatePEMBundle checks that a haproxy pem bundle holds a certificate
+// chain in leaf-to-root order, that every certificate in it is currently
+// valid, and that it holds exactly one private key matching the leaf.
+func validatePEMBundle(bundle []byte, now time.Time) error {
+	certBlocks, keyBlocks := splitPEMBundle(bundle)
+	if len(certBlocks) == 0 {
+		return fmt.Errorf("no certificates found")
+	}
+	if len(keyBlocks) != 1 {
+		return fmt.Errorf("expected exactly one private key, found %d", len(keyBlocks))
+	}
+
+	certs, err := parseCertificates(certBlocks)
+	if err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		if now.Before(cert.NotBefore) {
+			return fmt.Errorf("certificate %q is not valid until %v", cert.Subject.CommonName, cert.NotBefore)
+		}
+		if now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate %q expired on %v", cert.Subject.CommonName, cert.NotAfter)
+		}
+	}
+	for i := 0; i < len(certs)-1; i++ {
+		if err := certs[i].CheckSignatureFrom(certs[i+1]); err != nil {
+			return fmt.Errorf("certificate chain is not in leaf-to-root order: %q is not signed by %q", certs[i].Subject.CommonName, certs[i+1].Subject.CommonName)
+		}
+	}
+
+	leafPEM := pem.EncodeToMemory(certBlocks[0])
+	keyPEM := pem.EncodeToMemory(keyBlocks[0])
+	if _, err := tls.X509KeyPair(leafPEM, keyPEM); err != nil {
+		return fmt.Errorf("private key does not match leaf certificate %q: %v", certs[0].Subject.CommonName, err)
+	}
+	return nil
+}
+
+// splitPEMBundle separates the certificate and private key blocks of a pem
+// bundle, ignoring any other block types.
+func splitPEMBundle(bundle []byte) (certBlocks, keyBlocks []*pem.Block) {
+	for rest := bundle; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			certBlocks = append(certBlocks, block)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			keyBlocks = append(keyBlocks, block)
+		}
+	}
+	return certBlocks, keyBlocks
+}
+
+func parseCertificates(certBlocks []*pem.Block) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, block := range certBlocks {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
@@ -1,9 +1,15 @@
 package haproxy_plugin
 
+//go:generate go run ../cmd/enaml-gen/main.go -release ../.cache/haproxy-boshrelease?v=8.0.9 -job haproxy -out ../enaml-gen/haproxy -type ha_proxy.ssl_pem=[]string -type ha_proxy.stats_user=string -type ha_proxy.stats_password=string -type ha_proxy.resolvers=[]map[string]string -type ha_proxy.routed_backend_servers=map[string]RoutedBackendServer{port:int,servers:[]string}
+
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/enaml-ops/enaml"
 	"github.com/enaml-ops/haproxy-plugin/haproxy/enaml-gen/haproxy"
@@ -16,42 +22,209 @@ import (
 
 type Plugin struct {
 	Version string `omg:"-"`
+	Config  string `omg:"config,optional"`
 
 	DeploymentName      string   `omg:"deployment-name"`
 	NetworkName         string   `omg:"network-name"`
-	HaproxyReleaseVer   string   `omg:"haproxy-release-ver"`
+	HaproxyReleaseVer   string   `omg:"haproxy-release-ver,optional"`
 	HaproxyReleaseURL   string   `omg:"haproxy-release-url,optional"`
 	HaproxyReleaseSHA   string   `omg:"haproxy-release-sha,optional"`
+	ReleaseTarball      string   `omg:"release-tarball,optional"`
 	StemcellName        string   `omg:"stemcell-name"`
 	StemcellVer         string   `omg:"stemcell-ver"`
 	StemcellAlias       string   `omg:"stemcell-alias"`
 	StemcellURL         string   `omg:"stemcell-url,optional"`
 	StemcellSHA         string   `omg:"stemcell-sha,optional"`
 	AZs                 []string `omg:"az"`
-	GoRouterIPs         []string `omg:"gorouter-ip"`
-	HaProxyIP           string   `omg:"haproxy-ip"`
-	PEMFiles            []string `omg:"cert-filepath"`
+	GoRouterIPs         []string `omg:"gorouter-ip,optional"`
+	CFManifest          string   `omg:"cf-manifest,optional"`
+	DNSResolvers        []string `omg:"dns-resolver,optional"`
+	DNSHold             string   `omg:"dns-hold,optional"`
+	HaProxyIPs          []string `omg:"haproxy-ip,optional"`
+	HaProxyInstances    int      `omg:"haproxy-instances,optional"`
+	PEMFiles            []string `omg:"cert-filepath,optional"`
+	PEMStoreNames       []string `omg:"cert-from-store,optional"`
 	SyslogURL           string   `omg:"syslog-url,optional"`
 	InternalOnlyDomains []string `omg:"internal-only-domain,optional"`
 	TrustedDomainCidrs  []string `omg:"trusted-domain-cidr,optional"`
 	VMType              string   `omg:"vm-type"`
+	TCPMappings         []string `omg:"tcp-mapping,optional"`
+	RoutedBackends      []string `omg:"routed-backend,optional"`
+	TLSProfile          string   `omg:"tls-profile,optional"`
+	SSLCiphers          string   `omg:"ssl-ciphers,optional"`
+	DhParam             int      `omg:"dh-param,optional"`
+	RequestHeaders      []string `omg:"request-header,optional"`
+	ResponseHeaders     []string `omg:"response-header,optional"`
+	HeadersFile         string   `omg:"headers-file,optional"`
+	CompressTypes       []string `omg:"compress-type,optional"`
+
+	KeepalivedVIP             string `omg:"keepalived-vip,optional"`
+	KeepalivedVirtualRouterID int    `omg:"keepalived-virtual-router-id,optional"`
+	KeepalivedInterface       string `omg:"keepalived-interface,optional"`
+	KeepalivedReleaseVer      string `omg:"keepalived-release-ver,optional"`
+	KeepalivedReleaseURL      string `omg:"keepalived-release-url,optional"`
+	KeepalivedReleaseSHA      string `omg:"keepalived-release-sha,optional"`
+	KeepalivedReleaseTarball  string `omg:"keepalived-release-tarball,optional"`
+
+	AcceptProxy  bool `omg:"accept-proxy,optional"`
+	GoRouterPort int  `omg:"gorouter-port,optional"`
+
+	GoRouterLink           string `omg:"gorouter-link,optional"`
+	GoRouterLinkDeployment string `omg:"gorouter-link-deployment,optional"`
+
+	TimeoutProfile   string `omg:"timeout-profile,optional"`
+	ClientTimeout    int    `omg:"client-timeout,optional"`
+	ServerTimeout    int    `omg:"server-timeout,optional"`
+	ConnectTimeout   int    `omg:"connect-timeout,optional"`
+	KeepaliveTimeout int    `omg:"keepalive-timeout,optional"`
+	QueueTimeout     int    `omg:"queue-timeout,optional"`
+	RequestTimeout   int    `omg:"request-timeout,optional"`
+	WebsocketTimeout int    `omg:"websocket-timeout,optional"`
+
+	HTTPSRedirectAll     bool     `omg:"https-redirect-all,optional"`
+	HTTPSRedirectDomains []string `omg:"https-redirect-domain,optional"`
+	DisableHTTP          bool     `omg:"disable-http,optional"`
+
+	StatsEnable       bool     `omg:"stats-enable,optional"`
+	StatsUser         string   `omg:"stats-user,optional"`
+	StatsPassword     string   `omg:"stats-password,optional"`
+	StatsURI          string   `omg:"stats-uri,optional"`
+	TrustedStatsCidrs []string `omg:"trusted-stats-cidr,optional"`
+
+	UseBoshVariables bool     `omg:"use-bosh-variables,optional"`
+	SSLCertDomains   []string `omg:"ssl-cert-domain,optional"`
+	SSLCertVariable  string   `omg:"ssl-cert-variable,optional"`
+
+	keepalivedPassword    string
+	statsPassword         string
+	pems                  []string
+	tcpMappings           []haproxy.Tcp
+	routedBackends        map[string]haproxy.RoutedBackendServer
+	tlsProfile            tlsProfile
+	requestHeaders        map[string]string
+	responseHeaders       map[string]string
+	timeouts              *timeouts
+	compressTypes         string
+	resolvers             []map[string]string
+	jobSpec               *haproxy.JobSpec
+	haproxyReleaseName    string
+	keepalivedReleaseName string
+	keepalivedJobSpec     *haproxy.JobSpec
 }
 
 // GetProduct generates a BOSH deployment manifest for haproxy.
 func (p *Plugin) GetProduct(args []string, cloudConfig []byte, cs cred.Store) ([]byte, error) {
+	args, err := withConfigFile(args, p.GetFlags())
+	if err != nil {
+		return nil, err
+	}
 	c := pluginutil.NewContext(args, pluginutil.ToCliFlagArray(p.GetFlags()))
-	err := pcli.UnmarshalFlags(p, c)
+	err = pcli.UnmarshalFlags(p, c)
+	if err != nil {
+		return nil, err
+	}
+	p.haproxyReleaseName = releaseName
+	if err = p.loadReleaseTarball(); err != nil {
+		return nil, err
+	}
+	p.keepalivedReleaseName = keepalivedReleaseName
+	if err = p.loadKeepalivedTarball(); err != nil {
+		return nil, err
+	}
+	if err = p.selectRelease(); err != nil {
+		return nil, err
+	}
+	if err = p.validateGoRouterLink(); err != nil {
+		return nil, err
+	}
+	if err = p.loadGoRouterIPs(); err != nil {
+		return nil, err
+	}
+	cc, err := parseCloudConfig(cloudConfig)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.HaProxyIPs) == 0 {
+		if err = p.allocateHaProxyIPs(cc); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.validateHaProxyIPs(); err != nil {
+		return nil, err
+	}
+	if err = p.validateCloudConfig(cc); err != nil {
+		return nil, err
+	}
+	if p.keepalivedEnabled() {
+		if err = p.validateKeepalived(); err != nil {
+			return nil, err
+		}
+	}
+	if p.tcpMappings, err = p.newTCPMappings(); err != nil {
+		return nil, err
+	}
+	if p.routedBackends, err = p.newRoutedBackendServers(); err != nil {
+		return nil, err
+	}
+	if p.tlsProfile, err = p.newTLSProfile(); err != nil {
+		return nil, err
+	}
+	if p.requestHeaders, p.responseHeaders, err = p.newHeaders(); err != nil {
+		return nil, err
+	}
+	if err = p.validateHTTP(); err != nil {
+		return nil, err
+	}
+	if err = p.validateStats(); err != nil {
+		return nil, err
+	}
+	if p.timeouts, err = p.newTimeouts(); err != nil {
+		return nil, err
+	}
+	if err = p.validateProxyProtocol(); err != nil {
+		return nil, err
+	}
+	if p.compressTypes, err = p.newCompressTypes(); err != nil {
+		return nil, err
+	}
+	if err = p.validateBackendServers(); err != nil {
+		return nil, err
+	}
+	if p.resolvers, err = p.newResolvers(); err != nil {
+		return nil, err
+	}
+	if p.UseBoshVariables {
+		err = p.loadVariableSecrets()
+	} else {
+		err = p.loadSecrets(cs)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if err = p.validateRelease(); err != nil {
+		return nil, err
+	}
+	if p.keepalivedEnabled() {
+		if err = p.validateKeepalivedRelease(); err != nil {
+			return nil, err
+		}
+	}
 	deploymentManifest := new(enaml.DeploymentManifest)
 	deploymentManifest.SetName(p.DeploymentName)
 	deploymentManifest.AddRelease(enaml.Release{
-		Name:    releaseName,
+		Name:    p.haproxyReleaseName,
 		Version: p.HaproxyReleaseVer,
 		URL:     p.HaproxyReleaseURL,
 		SHA1:    p.HaproxyReleaseSHA,
 	})
+	if p.keepalivedEnabled() {
+		deploymentManifest.AddRelease(enaml.Release{
+			Name:    p.keepalivedReleaseName,
+			Version: p.KeepalivedReleaseVer,
+			URL:     p.KeepalivedReleaseURL,
+			SHA1:    p.KeepalivedReleaseSHA,
+		})
+	}
 	deploymentManifest.AddStemcell(enaml.Stemcell{
 		OS:      p.StemcellName,
 		Version: p.StemcellVer,
@@ -67,13 +240,38 @@ func (p *Plugin) GetProduct(args []string, cloudConfig []byte, cs cred.Store) ([
 		Canaries:        1,
 	}
 	deploymentManifest.AddInstanceGroup(p.newInstanceGroup())
+	if p.UseBoshVariables {
+		return p.manifestWithVariables(deploymentManifest)
+	}
 	return deploymentManifest.Bytes(), nil
 }
 
+// loadSecrets reads the pems and passwords the manifest needs inline,
+// generating and storing any passwords that don't exist yet.
+func (p *Plugin) loadSecrets(cs cred.Store) (err error) {
+	if p.SSLCertVariable != "" {
+		return fmt.Errorf("ssl-cert-variable can only be used with use-bosh-variables")
+	}
+	if p.pems, err = p.newPEMs(cs); err != nil {
+		return err
+	}
+	if p.keepalivedEnabled() {
+		if p.keepalivedPassword, err = getSecret(cs, keepalivedPasswordKey, newPassword); err != nil {
+			return err
+		}
+	}
+	if p.StatsEnable && p.StatsPassword == "" {
+		if p.statsPassword, err = getSecret(cs, statsPasswordKey, newStatsPassword); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (p *Plugin) newInstanceGroup() *enaml.InstanceGroup {
 	ig := &enaml.InstanceGroup{
 		VMType:    p.VMType,
-		Instances: DefaultHaProxyInstanceCount,
+		Instances: len(p.HaProxyIPs),
 		Name:      DefaultInstanceGroupName,
 		AZs:       p.AZs,
 		Stemcell:  p.StemcellAlias,
@@ -86,53 +284,306 @@ func (p *Plugin) newInstanceGroup() *enaml.InstanceGroup {
 func (p *Plugin) newNetworks() []enaml.Network {
 	var nets []enaml.Network
 	nets = append(nets, enaml.Network{
-		Name: p.NetworkName,
-		StaticIPs: []string{
-			p.HaProxyIP,
-		},
+		Name:      p.NetworkName,
+		StaticIPs: p.HaProxyIPs,
 	})
 	return nets
 }
 
-func (p *Plugin) newPEMs() []string {
+// validateHaProxyIPs makes sure every haproxy instance gets exactly one
+// static ip, since the number of ips given drives the instance count.
+func (p *Plugin) validateHaProxyIPs() error {
+	if len(p.HaProxyIPs) == 0 {
+		return fmt.Errorf("at least one haproxy-ip is required")
+	}
+	if p.HaProxyInstances != 0 && p.HaProxyInstances != len(p.HaProxyIPs) {
+		return fmt.Errorf("haproxy-instances is %d but %d haproxy-ips were given", p.HaProxyInstances, len(p.HaProxyIPs))
+	}
+	seen := make(map[string]bool)
+	for _, ip := range p.HaProxyIPs {
+		if seen[ip] {
+			return fmt.Errorf("haproxy-ip %s given more than once: each haproxy instance needs its own static ip", ip)
+		}
+		seen[ip] = true
+	}
+	return nil
+}
+
+// validateHTTP rejects http settings that contradict each other.
+func (p *Plugin) validateHTTP() error {
+	redirecting := p.HTTPSRedirectAll || len(p.HTTPSRedirectDomains) > 0
+	if redirecting && p.DisableHTTP {
+		return fmt.Errorf("https redirects need http traffic on port 80, which disable-http turns off")
+	}
+	if p.HTTPSRedirectAll && len(p.HTTPSRedirectDomains) > 0 {
+		return fmt.Errorf("https-redirect-domain has no effect with https-redirect-all, give only one of them")
+	}
+	return nil
+}
+
+// validateStats requires a trusted-stats-cidr with stats-enable, since the
+// release only lets 0.0.0.0/32 reach the stats UI by default.
+func (p *Plugin) validateStats() error {
+	if !p.StatsEnable {
+		return nil
+	}
+	if len(p.TrustedStatsCidrs) == 0 {
+		return fmt.Errorf("stats-enable needs at least one trusted-stats-cidr to allow access to the stats UI")
+	}
+	for _, cidr := range p.TrustedStatsCidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("trusted-stats-cidr '%s' is not a valid cidr", cidr)
+		}
+	}
+	return nil
+}
+
+// validateProxyProtocol checks the gorouter port, and warns when haproxy
+// accepts the PROXY protocol, since the release can't limit which sources
+// may send it and any client that can reach haproxy directly could then
+// spoof its source address. The release only accepts it on the https and
+// tcp binds, so http on port 80 has to be off for it to apply everywhere.
+func (p *Plugin) validateProxyProtocol() error {
+	if p.GoRouterPort < 0 || p.GoRouterPort > 65535 {
+		return fmt.Errorf("gorouter-port %d is out of range", p.GoRouterPort)
+	}
+	if p.AcceptProxy && !p.DisableHTTP {
+		return fmt.Errorf("accept-proxy needs disable-http, as the haproxy release does not accept the PROXY protocol on port 80")
+	}
+	if p.AcceptProxy {
+		lo.G.Warning("accept-proxy is on: make sure only the upstream load balancers can reach haproxy, or clients can spoof their source address")
+	}
+	return nil
+}
+
+func (p *Plugin) keepalivedEnabled() bool {
+	return p.KeepalivedVIP != ""
+}
+
+// validateKeepalived checks the vip and router id, and that there are at
+// least two haproxy instances for the vip to fail over between.
+func (p *Plugin) validateKeepalived() error {
+	if net.ParseIP(p.KeepalivedVIP) == nil {
+		return fmt.Errorf("keepalived-vip '%s' is not an ip", p.KeepalivedVIP)
+	}
+	if len(p.HaProxyIPs) < 2 {
+		return fmt.Errorf("keepalived-vip needs at least 2 haproxy instances to fail over between, got %d", len(p.HaProxyIPs))
+	}
+	if p.KeepalivedVirtualRouterID < 1 || p.KeepalivedVirtualRouterID > 255 {
+		return fmt.Errorf("keepalived-virtual-router-id must be between 1 and 255, got %d", p.KeepalivedVirtualRouterID)
+	}
+	for _, ip := range p.HaProxyIPs {
+		if ip == p.KeepalivedVIP {
+			return fmt.Errorf("keepalived-vip %s must not also be given as a haproxy-ip", ip)
+		}
+	}
+	return nil
+}
+
+// getSecret reads a secret from the credential store, generating and
+// storing a new one the first time the product is deployed so repeated
+// deploys render the same value. Only an empty secret counts as not found:
+// any error reading the store is returned rather than overwriting a secret
+// that may still be there.
+func getSecret(cs cred.Store, key string, generate func() (string, error)) (string, error) {
+	if cs == nil {
+		lo.G.Warningf("no credential store given, generating a %s that will not be persisted", key)
+		return generate()
+	}
+	secret, err := cs.Get(key)
+	if err != nil {
+		return "", fmt.Errorf("cant read %v from the credential store: %v", key, err)
+	}
+	if secret != "" {
+		return secret, nil
+	}
+	secret, err = generate()
+	if err != nil {
+		return "", err
+	}
+	if err = cs.Put(key, secret); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// newPassword returns a random password short enough for vrrp
+// authentication, which only considers the first 8 characters.
+func newPassword() (string, error) {
+	return newRandomHex(4)
+}
+
+func newStatsPassword() (string, error) {
+	return newRandomHex(16)
+}
+
+func newRandomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newKeepalivedPriorities assigns each haproxy instance a descending vrrp
+// priority, so the first haproxy-ip given holds the virtual ip by default.
+func (p *Plugin) newKeepalivedPriorities() map[string]int {
+	priorities := make(map[string]int)
+	for i, ip := range p.HaProxyIPs {
+		priorities[ip] = keepalivedBasePriority - i
+	}
+	return priorities
+}
+
+func (p *Plugin) newKeepalived() *Keepalived {
+	return &Keepalived{
+		VirtualIP:       p.KeepalivedVIP,
+		Interface:       p.KeepalivedInterface,
+		VirtualRouterID: p.KeepalivedVirtualRouterID,
+		Password:        p.keepalivedPassword,
+		Priorities:      p.newKeepalivedPriorities(),
+	}
+}
+
+func (p *Plugin) newPEMs(cs cred.Store) ([]string, error) {
 	var pems []string
 
+	if len(p.PEMFiles) == 0 && len(p.PEMStoreNames) == 0 {
+		return nil, fmt.Errorf("at least one cert-filepath or cert-from-store is required")
+	}
+
 	for _, pempath := range p.PEMFiles {
 		pem, err := ioutil.ReadFile(pempath)
-
 		if err != nil {
-			lo.G.Errorf("cant read pem file!!!, @ '%v' ", pempath)
-			break
+			return nil, fmt.Errorf("cant read pem file @ '%v': %v", pempath, err)
+		}
+		if err = validatePEMBundle(pem, time.Now()); err != nil {
+			return nil, fmt.Errorf("invalid pem file @ '%v': %v", pempath, err)
 		}
 		pems = append(pems, string(pem))
 	}
-	return pems
+
+	for _, name := range p.PEMStoreNames {
+		if cs == nil {
+			return nil, fmt.Errorf("cert-from-store '%v' given but no credential store is available", name)
+		}
+		pem, err := cs.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("cant read pem '%v' from the credential store: %v", name, err)
+		}
+		if pem == "" {
+			return nil, fmt.Errorf("no pem named '%v' in the credential store", name)
+		}
+		if err = validatePEMBundle([]byte(pem), time.Now()); err != nil {
+			return nil, fmt.Errorf("invalid pem '%v' in the credential store: %v", name, err)
+		}
+		pems = append(pems, pem)
+	}
+	return pems, nil
 }
 
 func (p *Plugin) newHaProxy() *haproxy.HaProxy {
 	ha := &haproxy.HaProxy{
 		BackendServers:      p.GoRouterIPs,
-		SslPem:              p.newPEMs(),
+		SslPem:              p.pems,
 		TrustedDomainCidrs:  strings.Join(p.TrustedDomainCidrs, " "),
 		InternalOnlyDomains: p.InternalOnlyDomains,
+		SslCiphers:          p.tlsProfile.Ciphers,
+		DefaultDhParam:      p.tlsProfile.DhParam,
 	}
 
 	if p.SyslogURL != "" {
 		ha.SyslogServer = p.SyslogURL
 	}
+
+	if len(p.tcpMappings) > 0 {
+		ha.Tcp = p.tcpMappings
+	}
+
+	if len(p.routedBackends) > 0 {
+		ha.RoutedBackendServers = p.routedBackends
+	}
+
+	if len(p.resolvers) > 0 {
+		ha.Resolvers = p.resolvers
+	}
+	if p.DNSHold != "" {
+		ha.DnsHold = p.DNSHold
+	}
+
+	if p.compressTypes != "" {
+		ha.CompressTypes = p.compressTypes
+	}
+
+	if p.AcceptProxy {
+		ha.AcceptProxy = true
+	}
+	if p.GoRouterPort != 0 {
+		ha.BackendPort = p.GoRouterPort
+	}
+
+	if p.timeouts != nil {
+		ha.ClientTimeout = p.timeouts.Client
+		ha.ServerTimeout = p.timeouts.Server
+		ha.ConnectTimeout = p.timeouts.Connect
+		ha.KeepaliveTimeout = p.timeouts.Keepalive
+		ha.QueueTimeout = p.timeouts.Queue
+		ha.RequestTimeout = p.timeouts.Request
+		ha.WebsocketTimeout = p.timeouts.Websocket
+	}
+
+	if p.HTTPSRedirectAll {
+		ha.HttpsRedirectAll = true
+	}
+	if len(p.HTTPSRedirectDomains) > 0 {
+		ha.HttpsRedirectDomains = p.HTTPSRedirectDomains
+	}
+	if p.DisableHTTP {
+		ha.DisableHttp = true
+	}
+
+	if len(p.requestHeaders) > 0 {
+		ha.Headers = p.requestHeaders
+	}
+	if len(p.responseHeaders) > 0 {
+		ha.RspHeaders = p.responseHeaders
+	}
+
+	if p.StatsEnable {
+		ha.StatsEnable = true
+		ha.StatsUser = p.StatsUser
+		ha.StatsPassword = p.statsPassword
+		if p.StatsPassword != "" {
+			ha.StatsPassword = p.StatsPassword
+		}
+		ha.StatsUri = p.StatsURI
+		if len(p.TrustedStatsCidrs) > 0 {
+			ha.TrustedStatsCidrs = strings.Join(p.TrustedStatsCidrs, " ")
+		}
+	}
 	return ha
 }
 
 func (p *Plugin) newJobs() []enaml.InstanceJob {
 	jobs := []enaml.InstanceJob{
 		enaml.InstanceJob{
-			Release: releaseName,
-			Name:    DefaultJobName,
+			Release:  p.haproxyReleaseName,
+			Name:     DefaultJobName,
+			Consumes: p.newConsumes(),
 			Properties: &haproxy.HaproxyJob{
 				HaProxy: p.newHaProxy(),
 			},
 		},
 	}
+	if p.keepalivedEnabled() {
+		jobs = append(jobs, enaml.InstanceJob{
+			Release: p.keepalivedReleaseName,
+			Name:    DefaultKeepalivedJobName,
+			Properties: &KeepalivedJob{
+				Keepalived: p.newKeepalived(),
+			},
+		})
+	}
 	return jobs
 }
 
@@ -152,7 +603,7 @@ func (p *Plugin) GetMeta() product.Meta {
 		Releases: []enaml.Release{
 			enaml.Release{
 				Name:    releaseName,
-				Version: releaseVersion,
+				Version: DefaultReleaseVersion,
 				URL:     DefaultReleaseURL,
 				SHA1:    DefaultReleaseSHA,
 			},
@@ -161,7 +612,7 @@ func (p *Plugin) GetMeta() product.Meta {
 			"version":              p.Version,
 			"stemcell":             defaultStemcellVersion,
 			"pivotal-gemfire-tile": "NOT COMPATIBLE WITH TILE RELEASES",
-			"haproxy":              fmt.Sprintf("%s / %s", releaseName, releaseVersion),
+			"haproxy":              fmt.Sprintf("%s / %s", releaseName, DefaultReleaseVersion),
 			"description":          "this plugin is designed to work with a special haproxy release",
 		},
 	}
@@ -170,6 +621,11 @@ func (p *Plugin) GetMeta() product.Meta {
 // GetFlags returns the CLI flags accepted by the plugin.
 func (p *Plugin) GetFlags() []pcli.Flag {
 	return []pcli.Flag{
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "config",
+			Usage:    "path to a YAML or JSON file of flag names to values; command line flags and OMG_* environment variables take precedence over it",
+		},
 		pcli.Flag{
 			FlagType: pcli.StringFlag,
 			Name:     "deployment-name",
@@ -222,36 +678,73 @@ func (p *Plugin) GetFlags() []pcli.Flag {
 		pcli.Flag{
 			FlagType: pcli.StringFlag,
 			Name:     "haproxy-release-ver",
-			Value:    releaseVersion,
-			Usage:    "the version of the release to use for the deployment",
+			Usage:    "the version of the release to use for the deployment, one of " + strings.Join(releaseVersions(), ", ") + " (defaults to " + DefaultReleaseVersion + ", or the version of the release-tarball)",
 		},
 		pcli.Flag{
 			FlagType: pcli.StringFlag,
 			Name:     "haproxy-release-url",
-			Value:    DefaultReleaseURL,
-			Usage:    "the URL of the release to use for the deployment",
+			Usage:    "the URL of the release to use for the deployment (defaults to the URL of the haproxy-release-ver)",
 		},
 		pcli.Flag{
 			FlagType: pcli.StringFlag,
 			Name:     "haproxy-release-sha",
-			Value:    DefaultReleaseSHA,
-			Usage:    "the SHA of the release to use for the deployment",
+			Usage:    "the SHA of the release to use for the deployment (defaults to the SHA of the haproxy-release-ver)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "release-tarball",
+			Usage:    "path to a local haproxy release tarball to deploy instead of downloading one, its name, version and SHA are read from it",
 		},
 		pcli.Flag{
 			FlagType: pcli.StringSliceFlag,
 			Name:     "gorouter-ip",
-			Usage:    "gorouter ips (give flag multiple times for multiple IPs)",
+			Usage:    "gorouter ips or hostnames, hostnames need a dns-resolver (give flag multiple times for multiple IPs)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "cf-manifest",
+			Usage:    "path to a Cloud Foundry deployment manifest to read the gorouter static ips on network-name from, instead of giving gorouter-ip",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "gorouter-link",
+			Usage:    "the name of a BOSH link providing the gorouter addresses, instead of giving gorouter-ip (needs a release-tarball whose haproxy job consumes an http_backend link, which the catalog releases do not)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "gorouter-link-deployment",
+			Usage:    "the deployment providing the gorouter-link, when it is not this deployment",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "dns-resolver",
+			Usage:    "ip of a dns server, queried on port 53, to resolve gorouter hostnames with (give flag multiple times for multiple servers)",
 		},
 		pcli.Flag{
 			FlagType: pcli.StringFlag,
+			Name:     "dns-hold",
+			Usage:    "how long to keep resolved gorouter addresses, e.g. 10s (defaults to the release default of 10s)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
 			Name:     "haproxy-ip",
-			Usage:    "ip for haproxy vm to listen on",
+			Usage:    "ip for haproxy vm to listen on (give flag multiple times to deploy one haproxy instance per IP; when omitted, ips are allocated from the cloud config)",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "haproxy-instances",
+			Usage:    "the number of haproxy instances to allocate static ips for from the cloud config when no haproxy-ip is given (defaults to 1)",
 		},
 		pcli.Flag{
 			FlagType: pcli.StringSliceFlag,
 			Name:     "cert-filepath",
 			Usage:    "the path to your pem file containing entire chain (give multiple flags to use multiple pems)",
 		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "cert-from-store",
+			Usage:    "the name of a pem containing entire chain and key to load from the credential store instead of from disk (give multiple flags to use multiple pems)",
+		},
 		pcli.Flag{
 			FlagType: pcli.StringFlag,
 			Name:     "syslog-url",
@@ -267,5 +760,197 @@ func (p *Plugin) GetFlags() []pcli.Flag {
 			Name:     "trusted-domain-cidr",
 			Usage:    "trusted domain cidrs to be used with internal only domains (give multiple flags to use multiple cidrs)",
 		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "tls-profile",
+			Value:    defaultTLSProfile,
+			Usage:    "the tls cipher preset to use: modern, intermediate or legacy (following Mozilla's guidance), or custom to give ssl-ciphers and dh-param",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "ssl-ciphers",
+			Usage:    "the OpenSSL cipher string to use with the custom tls-profile",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "dh-param",
+			Usage:    "the maximum size of dh params to use with the custom tls-profile (defaults to 2048)",
+		},
+		pcli.Flag{
+			FlagType: pcli.BoolFlag,
+			Name:     "accept-proxy",
+			Usage:    "accept the PROXY protocol from an upstream L4 load balancer, to keep client ips",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "gorouter-port",
+			Usage:    "the port the gorouters listen on (defaults to 80)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "timeout-profile",
+			Value:    timeoutProfileDefault,
+			Usage:    "the timeout preset to use: default (the release defaults), websocket or long-poll; individual timeout flags take precedence",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "client-timeout",
+			Usage:    "timeout waiting for data from a client, in seconds (overrides the timeout-profile)",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "server-timeout",
+			Usage:    "timeout waiting for data from a server, in seconds (overrides the timeout-profile)",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "connect-timeout",
+			Usage:    "timeout waiting for connections to establish to a server, in seconds (overrides the timeout-profile)",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "keepalive-timeout",
+			Usage:    "timeout waiting for new http requests under http keep-alive mode, in seconds (overrides the timeout-profile)",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "queue-timeout",
+			Usage:    "timeout for requests queued waiting for free connection slots, in seconds (overrides the timeout-profile)",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "request-timeout",
+			Usage:    "timeout for receiving a complete http request, in seconds (overrides the timeout-profile)",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "websocket-timeout",
+			Usage:    "timeout for websocket/tunnel traffic, in seconds (overrides the timeout-profile)",
+		},
+		pcli.Flag{
+			FlagType: pcli.BoolFlag,
+			Name:     "https-redirect-all",
+			Usage:    "redirect all http requests to https",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "https-redirect-domain",
+			Usage:    "redirect http requests for this domain and its subdomains to https (give multiple flags for multiple domains)",
+		},
+		pcli.Flag{
+			FlagType: pcli.BoolFlag,
+			Name:     "disable-http",
+			Usage:    "disable http traffic on port 80",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "compress-type",
+			Usage:    "a mime type to gzip compress, or 'text' for the common text types (give multiple flags for multiple types)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "request-header",
+			Usage:    "a 'Name: value' header to set on each request (give multiple flags for multiple headers)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "response-header",
+			Usage:    "a 'Name: value' header to set on each response (give multiple flags for multiple headers)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "headers-file",
+			Usage:    "path to a YAML file with 'request' and 'response' maps of header names to values (request-header and response-header flags take precedence)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "routed-backend",
+			Usage:    "send requests for a url prefix to a separate pool of gorouters, as prefix:port:router-ip[:router-ip...] (give multiple flags for multiple prefixes)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "tcp-mapping",
+			Usage:    "proxy a tcp port to backend servers, as name:port:backend-port:backend-server[:backend-server...] (give multiple flags for multiple mappings)",
+		},
+		pcli.Flag{
+			FlagType: pcli.BoolFlag,
+			Name:     "stats-enable",
+			Usage:    "enable the haproxy stats UI on port 9000",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "stats-user",
+			Value:    defaultStatsUser,
+			Usage:    "the user name to authenticate to the haproxy stats UI",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "stats-password",
+			Usage:    "the password to authenticate to the haproxy stats UI (this is optional: a strong password is generated and kept in the credential store by default)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "stats-uri",
+			Value:    defaultStatsURI,
+			Usage:    "the URI of the haproxy stats UI",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "trusted-stats-cidr",
+			Usage:    "trusted cidrs allowed to access the haproxy stats UI (give multiple flags to use multiple cidrs)",
+		},
+		pcli.Flag{
+			FlagType: pcli.BoolFlag,
+			Name:     "use-bosh-variables",
+			Usage:    "render certs and passwords as ((variables)) for the bosh director / config server to generate, instead of inline secrets",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "ssl-cert-domain",
+			Usage:    "domain for the bosh generated ssl cert when using bosh variables, the first is the common name (give multiple flags for multiple domains)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "ssl-cert-variable",
+			Usage:    "name of an existing certificate in the config server to use when using bosh variables, instead of generating one for ssl-cert-domain",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "keepalived-vip",
+			Usage:    "floating virtual ip shared by the haproxy instances via keepalived (keepalived is only deployed when this is given)",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "keepalived-virtual-router-id",
+			Value:    defaultKeepalivedVirtualRouterID,
+			Usage:    "the vrrp virtual router id (1-255) for the keepalived vip, must be unique on the network",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "keepalived-interface",
+			Value:    defaultKeepalivedInterface,
+			Usage:    "the network interface keepalived binds the vip to",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "keepalived-release-ver",
+			Value:    keepalivedReleaseVersion,
+			Usage:    "the version of the keepalived release to use for the deployment",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "keepalived-release-url",
+			Usage:    "the URL of the keepalived release to use (this is optional: it will use a release that already exists in bosh by default)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "keepalived-release-sha",
+			Usage:    "the SHA of the keepalived release to use (if you're giving a optional release URL)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "keepalived-release-tarball",
+			Usage:    "path to a local keepalived release tarball to deploy, its name, version and SHA are read from it and the keepalived properties are checked against its keepalived job",
+		},
 	}
 }
@@ -1,10 +1,22 @@
 package haproxy_plugin_test
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
@@ -113,7 +125,7 @@ var _ = Describe("haproxy plugin", func() {
 		Describe("trusted domain cidrs", func() {
 			Context("when called with a list of trusted domain cidrs", func() {
 				It("should configure the deployment with trusted domain cidrs", func() {
-					listOfCIDRs := strings.Split(haproxyJobProperties.HaProxy.TrustedDomainCidrs.(string), " ")
+					listOfCIDRs := strings.Split(haproxyJobProperties.HaProxy.TrustedDomainCidrs, " ")
 					Ω(listOfCIDRs).Should(ConsistOf(controlCIDRs))
 				})
 			})
@@ -150,7 +162,7 @@ var _ = Describe("haproxy plugin", func() {
 					Ω(err).ShouldNot(HaveOccurred())
 				})
 				It("should NOT add the value to the job properties", func() {
-					Ω(haproxyJobProperties.HaProxy.SyslogServer).Should(BeNil())
+					Ω(haproxyJobProperties.HaProxy.SyslogServer).Should(BeZero())
 				})
 			})
 		})
@@ -161,7 +173,7 @@ var _ = Describe("haproxy plugin", func() {
 					var controlPEM string
 					pemBytes, _ := ioutil.ReadFile("fixtures/pem1.pem")
 					controlPEM = string(pemBytes)
-					sslPemRecord := haproxyJobProperties.HaProxy.SslPem.([]interface{})
+					sslPemRecord := haproxyJobProperties.HaProxy.SslPem
 					Ω(len(sslPemRecord)).Should(Equal(1), "for only one file given should create only a single record")
 					Ω(sslPemRecord[0]).Should(Equal(controlPEM))
 				})
@@ -198,7 +210,7 @@ var _ = Describe("haproxy plugin", func() {
 					controlPEM1 = string(pemBytes)
 					pemBytes, _ = ioutil.ReadFile("fixtures/pem2.pem")
 					controlPEM2 = string(pemBytes)
-					sslPemRecord := haproxyJobProperties.HaProxy.SslPem.([]interface{})
+					sslPemRecord := haproxyJobProperties.HaProxy.SslPem
 					Ω(len(sslPemRecord)).Should(Equal(2), "we should have a pem for each file given as an argument")
 					Ω(sslPemRecord).Should(ConsistOf(controlPEM1, controlPEM2))
 				})
@@ -211,13 +223,48 @@ var _ = Describe("haproxy plugin", func() {
 			})
 
 			It("should properly set the static ip for the haproxy vm instance", func() {
-				Ω(haproxyInstanceGroup.Instances).Should(Equal(DefaultHaProxyInstanceCount), "we only ever want one haproxy VM for now")
+				Ω(haproxyInstanceGroup.Instances).Should(Equal(1), "we should have one haproxy VM per given ip")
 				Ω(len(haproxyInstanceGroup.Networks)).Should(BeNumerically(">", 0))
-				Ω(len(haproxyInstanceGroup.Networks[0].StaticIPs)).Should(Equal(DefaultHaProxyInstanceCount), "we only ever want one haproxy VM for now")
 				Ω(haproxyInstanceGroup.Networks[0].StaticIPs).Should(ConsistOf(controlHaProxyIP))
 			})
 		})
 
+		Context("when given multiple ips for haproxy", func() {
+			var controlHaProxyIPs = []string{
+				"1.1.1.1",
+				"1.1.1.2",
+			}
+			var noIPArgs = []string{
+				"haproxy-command",
+				"--cert-filepath", "fixtures/pem1.pem",
+				"--az", "z1",
+				"--network-name", controlNetworkName,
+				"--stemcell-alias", "trusty",
+				"--vm-type", "sadfasdf",
+				"--gorouter-ip", controlBackendIPs[0],
+			}
+
+			It("should create a haproxy vm instance for each static ip", func() {
+				args := append([]string{}, noIPArgs...)
+				for _, ip := range controlHaProxyIPs {
+					args = append(args, "--haproxy-ip", ip)
+				}
+				manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				manifest := enaml.NewDeploymentManifest(manifestBytes)
+				instanceGroup := manifest.GetInstanceGroupByName(DefaultInstanceGroupName)
+				Ω(instanceGroup.Instances).Should(Equal(len(controlHaProxyIPs)))
+				Ω(instanceGroup.Networks[0].StaticIPs).Should(ConsistOf(controlHaProxyIPs))
+			})
+
+			It("should return an error when an ip is given more than once", func() {
+				args := append([]string{}, noIPArgs...)
+				args = append(args, "--haproxy-ip", controlHaProxyIPs[0], "--haproxy-ip", controlHaProxyIPs[0])
+				_, err := hplugin.GetProduct(args, []byte{}, nil)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+
 		Context("when given config values for backend server info (go router ips)", func() {
 			It("then it should define a list of backend server IPs", func() {
 				Ω(haproxyJobProperties.HaProxy.BackendServers).Should(ConsistOf(controlBackendIPs))
@@ -299,7 +346,9 @@ var _ = Describe("haproxy plugin", func() {
 				Ω(manifest.Releases).ShouldNot(BeEmpty())
 				Ω(manifest.Releases[0]).ShouldNot(BeNil())
 				Ω(manifest.Releases[0].Name).Should(Equal("haproxy"))
-				Ω(manifest.Releases[0].Version).Should(Equal("latest"))
+				Ω(manifest.Releases[0].Version).Should(Equal(DefaultReleaseVersion))
+				Ω(manifest.Releases[0].URL).Should(Equal(DefaultReleaseURL))
+				Ω(manifest.Releases[0].SHA1).Should(Equal(DefaultReleaseSHA))
 			})
 
 			It("should properly set up the stemcells", func() {
@@ -326,4 +375,1554 @@ var _ = Describe("haproxy plugin", func() {
 			})
 		})
 	})
-})
+
+	Context("When validating pem bundles", func() {
+		var noPEMArgs = []string{
+			"haproxy-command",
+			"--az", "z1",
+			"--network-name", "net1",
+			"--vm-type", "small",
+			"--gorouter-ip", "10.0.0.20",
+			"--haproxy-ip", "10.0.0.10",
+		}
+
+		getProductWithPEM := func(pemPath string) error {
+			hplugin = &Plugin{Version: "0.0"}
+			args := append([]string{}, noPEMArgs...)
+			_, err := hplugin.GetProduct(append(args, "--cert-filepath", pemPath), []byte{}, nil)
+			return err
+		}
+
+		It("should accept a valid bundle", func() {
+			Ω(getProductWithPEM("fixtures/pem1.pem")).Should(Succeed())
+		})
+
+		It("should return an error when the pem file can not be read", func() {
+			Ω(getProductWithPEM("fixtures/does-not-exist.pem")).ShouldNot(Succeed())
+		})
+
+		It("should return an error when the bundle has no private key", func() {
+			Ω(getProductWithPEM("fixtures/pem-no-key.pem")).Should(MatchError(ContainSubstring("exactly one private key")))
+		})
+
+		It("should return an error when the bundle has more than one private key", func() {
+			Ω(getProductWithPEM("fixtures/pem-two-keys.pem")).Should(MatchError(ContainSubstring("exactly one private key")))
+		})
+
+		It("should return an error when the private key does not match the leaf", func() {
+			Ω(getProductWithPEM("fixtures/pem-mismatched-key.pem")).Should(MatchError(ContainSubstring("does not match")))
+		})
+
+		It("should return an error when the chain is not in leaf-to-root order", func() {
+			Ω(getProductWithPEM("fixtures/pem-out-of-order.pem")).Should(MatchError(ContainSubstring("leaf-to-root")))
+		})
+
+		It("should return an error when a certificate has expired", func() {
+			Ω(getProductWithPEM("fixtures/pem-expired.pem")).Should(MatchError(ContainSubstring("expired")))
+		})
+
+		It("should return an error when a certificate is not yet valid", func() {
+			Ω(getProductWithPEM("fixtures/pem-not-yet-valid.pem")).Should(MatchError(ContainSubstring("not valid until")))
+		})
+
+		It("should return an error when no pem is given", func() {
+			hplugin = &Plugin{Version: "0.0"}
+			_, err := hplugin.GetProduct(noPEMArgs, []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		Context("when loading pems from the credential store", func() {
+			var store *fakeStore
+			var controlPEM []byte
+
+			BeforeEach(func() {
+				hplugin = &Plugin{Version: "0.0"}
+				controlPEM, _ = ioutil.ReadFile("fixtures/pem1.pem")
+				store = &fakeStore{creds: map[string]string{
+					"apps-cert":    string(controlPEM),
+					"invalid-cert": "not a pem",
+				}}
+			})
+
+			It("should add the stored pem to the haproxy job", func() {
+				args := append([]string{}, noPEMArgs...)
+				manifestBytes, err := hplugin.GetProduct(append(args, "--cert-from-store", "apps-cert"), []byte{}, store)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(getHaProxyProperties(manifestBytes).SslPem).Should(ConsistOf(string(controlPEM)))
+			})
+
+			It("should return an error when the pem is not in the store", func() {
+				args := append([]string{}, noPEMArgs...)
+				_, err := hplugin.GetProduct(append(args, "--cert-from-store", "missing-cert"), []byte{}, store)
+				Ω(err).Should(MatchError(ContainSubstring("missing-cert")))
+			})
+
+			It("should return an error when the stored pem is invalid", func() {
+				args := append([]string{}, noPEMArgs...)
+				_, err := hplugin.GetProduct(append(args, "--cert-from-store", "invalid-cert"), []byte{}, store)
+				Ω(err).Should(HaveOccurred())
+			})
+
+			It("should return an error when there is no credential store", func() {
+				args := append([]string{}, noPEMArgs...)
+				_, err := hplugin.GetProduct(append(args, "--cert-from-store", "apps-cert"), []byte{}, nil)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Context("When running a cert report", func() {
+		var out *bytes.Buffer
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			out = new(bytes.Buffer)
+		})
+
+		It("should report every cert in every bundle as json", func() {
+			err := hplugin.GetCertReport([]string{
+				CertReportCommand,
+				"--cert-filepath", "fixtures/pem1.pem",
+				"--cert-filepath", "fixtures/pem2.pem",
+				"--format", "json",
+			}, out)
+			Ω(err).ShouldNot(HaveOccurred())
+			var reports []CertReport
+			Ω(json.Unmarshal(out.Bytes(), &reports)).Should(Succeed())
+			Ω(reports).Should(HaveLen(5), "pem1 holds a 3 cert chain and pem2 a 2 cert chain")
+			Ω(reports[0].Bundle).Should(Equal("fixtures/pem1.pem"))
+			Ω(reports[0].Subject).Should(Equal("apps.example.com"))
+			Ω(reports[0].SANs).Should(ConsistOf("apps.example.com"))
+			Ω(reports[0].Issuer).Should(Equal("Example Intermediate CA"))
+			Ω(reports[0].DaysRemaining).Should(BeNumerically(">", 30))
+		})
+
+		It("should report as a table by default", func() {
+			err := hplugin.GetCertReport([]string{
+				CertReportCommand,
+				"--cert-filepath", "fixtures/pem1.pem",
+			}, out)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(out.String()).Should(ContainSubstring("DAYS REMAINING"))
+			Ω(out.String()).Should(ContainSubstring("apps.example.com"))
+		})
+
+		It("should return an error when a cert expires within the window", func() {
+			err := hplugin.GetCertReport([]string{
+				CertReportCommand,
+				"--cert-filepath", "fixtures/pem-expired.pem",
+			}, out)
+			Ω(err).Should(MatchError(ContainSubstring("expired.example.com")))
+			Ω(out.String()).Should(ContainSubstring("expired.example.com"), "the report should still be printed")
+		})
+
+		It("should count a cert that expired hours ago as expired", func() {
+			pempath := writeCert(time.Now().Add(-12 * time.Hour))
+			defer os.RemoveAll(filepath.Dir(pempath))
+			err := hplugin.GetCertReport([]string{
+				CertReportCommand,
+				"--cert-filepath", pempath,
+				"--expiry-window-days", "0",
+				"--format", "json",
+			}, out)
+			Ω(err).Should(MatchError(ContainSubstring("hours.example.com")))
+			var reports []CertReport
+			Ω(json.Unmarshal(out.Bytes(), &reports)).Should(Succeed())
+			Ω(reports[0].DaysRemaining).Should(Equal(-1))
+		})
+
+		It("should use the configured expiry window", func() {
+			err := hplugin.GetCertReport([]string{
+				CertReportCommand,
+				"--cert-filepath", "fixtures/pem1.pem",
+				"--expiry-window-days", "100000",
+			}, out)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return an error for an unknown format", func() {
+			err := hplugin.GetCertReport([]string{
+				CertReportCommand,
+				"--cert-filepath", "fixtures/pem1.pem",
+				"--format", "xml",
+			}, out)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When using bosh variables", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = []string{
+				"haproxy-command",
+				"--az", "z1",
+				"--network-name", "net1",
+				"--vm-type", "small",
+				"--gorouter-ip", "10.0.0.20",
+				"--haproxy-ip", "10.0.0.10",
+				"--haproxy-ip", "10.0.0.11",
+				"--stats-enable",
+				"--trusted-stats-cidr", "10.0.0.0/24",
+				"--use-bosh-variables",
+				"--ssl-cert-domain", "*.apps.example.com",
+				"--ssl-cert-domain", "*.system.example.com",
+			}
+		})
+
+		getVariablesManifest := func(manifestBytes []byte) (*haproxy.HaProxy, []map[string]interface{}) {
+			var raw struct {
+				Variables []map[string]interface{} `yaml:"variables"`
+			}
+			Ω(yaml.Unmarshal(manifestBytes, &raw)).Should(Succeed())
+			return getHaProxyProperties(manifestBytes), raw.Variables
+		}
+
+		It("should reference variables instead of inlining secrets", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha, _ := getVariablesManifest(manifestBytes)
+			Ω(ha.SslPem).Should(ConsistOf("((haproxy_ssl.certificate))\n((haproxy_ssl.private_key))"))
+			Ω(ha.StatsPassword).Should(Equal("((haproxy_stats_password))"))
+			Ω(string(manifestBytes)).ShouldNot(ContainSubstring("PRIVATE KEY"))
+		})
+
+		It("should define the variables", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			_, variables := getVariablesManifest(manifestBytes)
+			var names []interface{}
+			for _, v := range variables {
+				names = append(names, v["name"])
+			}
+			Ω(names).Should(ConsistOf("haproxy_ca", "haproxy_ssl", "haproxy_stats_password"))
+			sslOptions := variables[1]["options"].(map[interface{}]interface{})
+			Ω(sslOptions["ca"]).Should(Equal("haproxy_ca"))
+			Ω(sslOptions["common_name"]).Should(Equal("*.apps.example.com"))
+			Ω(sslOptions["alternative_names"]).Should(ConsistOf("*.apps.example.com", "*.system.example.com"))
+		})
+
+		It("should define a keepalived password variable when keepalived is enabled", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--keepalived-vip", "10.0.0.100"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(manifestBytes)).Should(ContainSubstring("((keepalived_password))"))
+			_, variables := getVariablesManifest(manifestBytes)
+			Ω(variables[len(variables)-1]["name"]).Should(Equal("keepalived_password"))
+		})
+
+		It("should reference an existing cert without defining it", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args[:len(args)-4], "--ssl-cert-variable", "/shared/haproxy_ssl"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha, variables := getVariablesManifest(manifestBytes)
+			Ω(ha.SslPem).Should(ConsistOf("((/shared/haproxy_ssl.certificate))\n((/shared/haproxy_ssl.private_key))"))
+			var names []interface{}
+			for _, v := range variables {
+				names = append(names, v["name"])
+			}
+			Ω(names).Should(ConsistOf("haproxy_stats_password"))
+		})
+
+		It("should return an error when ssl cert domains are also given with an existing cert", func() {
+			_, err := hplugin.GetProduct(append(args, "--ssl-cert-variable", "haproxy_ssl"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("ssl-cert-variable")))
+		})
+
+		It("should return an error for an invalid cert variable name", func() {
+			_, err := hplugin.GetProduct(append(args[:len(args)-4], "--ssl-cert-variable", "haproxy ssl))"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("should only contain")))
+		})
+
+		It("should return an error for an existing cert without bosh variables", func() {
+			_, err := hplugin.GetProduct(argsWith("--gorouter-ip", "10.0.0.20", "--ssl-cert-variable", "haproxy_ssl"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("use-bosh-variables")))
+		})
+
+		It("should return an error when no ssl cert domain is given", func() {
+			_, err := hplugin.GetProduct(args[:len(args)-4], []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return an error when pem files are also given", func() {
+			_, err := hplugin.GetProduct(append(args, "--cert-filepath", "fixtures/pem1.pem"), []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When stats are enabled without bosh variables", func() {
+		var args []string
+		var store *fakeStore
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			store = &fakeStore{creds: map[string]string{}}
+			args = argsWith("--gorouter-ip", "10.0.0.20", "--trusted-stats-cidr", "10.0.0.0/24", "--stats-enable")
+		})
+
+		It("should enable stats with the default user and uri", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.StatsEnable).Should(BeTrue())
+			Ω(ha.StatsUser).Should(Equal("haproxy_stats"))
+			Ω(ha.StatsUri).Should(Equal("haproxy_stats"))
+			Ω(ha.TrustedStatsCidrs).Should(Equal("10.0.0.0/24"))
+		})
+
+		It("should return an error when no trusted stats cidr is given", func() {
+			_, err := hplugin.GetProduct(argsWith("--gorouter-ip", "10.0.0.20", "--stats-enable"), []byte{}, store)
+			Ω(err).Should(MatchError(ContainSubstring("trusted-stats-cidr")))
+		})
+
+		It("should return an error for an invalid trusted stats cidr", func() {
+			_, err := hplugin.GetProduct(append(args, "--trusted-stats-cidr", "10.0.0.0"), []byte{}, store)
+			Ω(err).Should(MatchError(ContainSubstring("not a valid cidr")))
+		})
+
+		It("should generate and store a stats password", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(store.creds["haproxy-stats-password"]).Should(HaveLen(32))
+			Ω(getHaProxyProperties(manifestBytes).StatsPassword).Should(Equal(store.creds["haproxy-stats-password"]))
+			Ω(string(manifestBytes)).ShouldNot(ContainSubstring("variables:"))
+		})
+
+		It("should reuse the stored stats password", func() {
+			store.creds["haproxy-stats-password"] = "stored-password"
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).StatsPassword).Should(Equal("stored-password"))
+		})
+
+		It("should use the customised stats settings", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--stats-user", "ops",
+				"--stats-password", "given-password",
+				"--stats-uri", "stats",
+				"--trusted-stats-cidr", "10.0.1.0/24",
+			), []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.StatsUser).Should(Equal("ops"))
+			Ω(ha.StatsPassword).Should(Equal("given-password"))
+			Ω(ha.StatsUri).Should(Equal("stats"))
+			Ω(ha.TrustedStatsCidrs).Should(Equal("10.0.0.0/24 10.0.1.0/24"))
+			Ω(store.creds).ShouldNot(HaveKey("haproxy-stats-password"), "a given password should not be generated")
+		})
+
+		It("should not configure stats unless enabled", func() {
+			manifestBytes, err := hplugin.GetProduct(args[:len(args)-1], []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.StatsEnable).Should(BeZero())
+			Ω(ha.StatsPassword).Should(BeZero())
+		})
+	})
+
+	Context("When tcp mappings are passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--gorouter-ip", "10.0.0.20")
+		})
+
+		It("should render the mappings into the tcp property", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--tcp-mapping", "mqtt:1883:1883:10.0.0.30:10.0.0.31",
+				"--tcp-mapping", "mysql:3306:13306:10.0.0.40",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			tcp := getHaProxyProperties(manifestBytes).Tcp
+			Ω(tcp).Should(HaveLen(2))
+			Ω(tcp[0].Name).Should(Equal("mqtt"))
+			Ω(tcp[0].Port).Should(Equal(1883))
+			Ω(tcp[0].BackendPort).Should(Equal(1883))
+			Ω(tcp[0].BackendServers).Should(ConsistOf("10.0.0.30", "10.0.0.31"))
+			Ω(tcp[1].Name).Should(Equal("mysql"))
+			Ω(tcp[1].Port).Should(Equal(3306))
+			Ω(tcp[1].BackendPort).Should(Equal(13306))
+		})
+
+		It("should not render the tcp property when no mappings are given", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(manifestBytes)).ShouldNot(ContainSubstring("tcp:"))
+		})
+
+		It("should return an error when a mapping uses an http port", func() {
+			for _, port := range []string{"80", "443", "4443"} {
+				_, err := hplugin.GetProduct(append(args, "--tcp-mapping", "web:"+port+":8080:10.0.0.30"), []byte{}, nil)
+				Ω(err).Should(MatchError(ContainSubstring("already used")), port)
+			}
+		})
+
+		It("should return an error when two mappings use the same port", func() {
+			_, err := hplugin.GetProduct(append(args,
+				"--tcp-mapping", "mqtt:1883:1883:10.0.0.30",
+				"--tcp-mapping", "other:1883:1884:10.0.0.31",
+			), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("already used by mqtt")))
+		})
+
+		It("should return an error when two mappings have the same name", func() {
+			_, err := hplugin.GetProduct(append(args,
+				"--tcp-mapping", "a:1883:1883:10.0.0.30",
+				"--tcp-mapping", "a:1884:1884:10.0.0.31",
+			), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("more than once")))
+		})
+
+		It("should return an error for a name haproxy can not use", func() {
+			for _, name := range []string{"my mqtt", "mqtt#1", "mqtt/1"} {
+				_, err := hplugin.GetProduct(append(args, "--tcp-mapping", name+":1883:1883:10.0.0.30"), []byte{}, nil)
+				Ω(err).Should(MatchError(ContainSubstring("should only contain")), name)
+			}
+		})
+
+		It("should return an error when a mapping uses the stats port with stats enabled", func() {
+			_, err := hplugin.GetProduct(append(args, "--stats-enable", "--trusted-stats-cidr", "10.0.0.0/24", "--tcp-mapping", "web:9000:8080:10.0.0.30"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("already used by stats")))
+		})
+
+		It("should allow the stats port when stats are not enabled", func() {
+			_, err := hplugin.GetProduct(append(args, "--tcp-mapping", "web:9000:8080:10.0.0.30"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should return an error for a malformed mapping", func() {
+			for _, mapping := range []string{"mqtt:1883:1883", "mqtt:port:1883:10.0.0.30", "mqtt:1883:70000:10.0.0.30", ":1883:1883:10.0.0.30"} {
+				_, err := hplugin.GetProduct(append(args, "--tcp-mapping", mapping), []byte{}, nil)
+				Ω(err).Should(HaveOccurred(), mapping)
+			}
+		})
+	})
+
+	Context("When routed backends are passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--gorouter-ip", "10.0.0.20")
+		})
+
+		It("should map each prefix to its router port and ips", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--routed-backend", "/segment-a:80:10.1.0.20:10.1.0.21",
+				"--routed-backend", "/segment-b:8080:10.2.0.20",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			routed := getHaProxyProperties(manifestBytes).RoutedBackendServers
+			Ω(routed).Should(HaveLen(2))
+			Ω(routed["/segment-a"].Port).Should(Equal(80))
+			Ω(routed["/segment-a"].Servers).Should(ConsistOf("10.1.0.20", "10.1.0.21"))
+			Ω(routed["/segment-b"].Port).Should(Equal(8080))
+			Ω(routed["/segment-b"].Servers).Should(ConsistOf("10.2.0.20"))
+		})
+
+		It("should not render routed backends when none are given", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).RoutedBackendServers).Should(BeEmpty())
+		})
+
+		It("should return an error for overlapping prefixes", func() {
+			for _, prefixes := range [][]string{
+				{"/foo", "/foo"},
+				{"/foo", "/foo/bar"},
+				{"/foo/bar", "/foo"},
+				{"/foo", "/foobar"},
+			} {
+				_, err := hplugin.GetProduct(append(args,
+					"--routed-backend", prefixes[0]+":80:10.1.0.20",
+					"--routed-backend", prefixes[1]+":80:10.2.0.20",
+				), []byte{}, nil)
+				Ω(err).Should(MatchError(ContainSubstring("overlaps")), strings.Join(prefixes, " "))
+			}
+		})
+
+		It("should return an error for a malformed routed backend", func() {
+			for _, routed := range []string{"/foo", "/foo:10.1.0.20", "foo:80:10.1.0.20", "/:80:10.1.0.20", "/foo bar:80:10.1.0.20", "/foo:80::10.1.0.20", "/foo:99999:10.1.0.20"} {
+				_, err := hplugin.GetProduct(append(args, "--routed-backend", routed), []byte{}, nil)
+				Ω(err).Should(HaveOccurred(), routed)
+			}
+		})
+	})
+
+	Context("When a config file is passed", func() {
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+		})
+
+		It("should read flag values from a yaml config file", func() {
+			manifestBytes, err := hplugin.GetProduct([]string{
+				"haproxy-command",
+				"--config", "fixtures/config.yml",
+			}, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(hplugin.DeploymentName).Should(Equal("haproxy-from-config"))
+			Ω(hplugin.AZs).Should(ConsistOf("z1", "z2"))
+			Ω(hplugin.GoRouterIPs).Should(ConsistOf("10.0.0.20", "10.0.0.21"))
+			Ω(hplugin.StatsEnable).Should(BeTrue())
+			Ω(hplugin.KeepalivedVirtualRouterID).Should(Equal(7))
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			Ω(manifest.Name).Should(Equal("haproxy-from-config"))
+		})
+
+		It("should read flag values from a json config file", func() {
+			manifestBytes, err := hplugin.GetProduct([]string{
+				"haproxy-command",
+				"--config", "fixtures/config.json",
+			}, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			Ω(manifest.GetInstanceGroupByName(DefaultInstanceGroupName).Instances).Should(Equal(2))
+		})
+
+		It("should prefer command line flags over the config file", func() {
+			_, err := hplugin.GetProduct([]string{
+				"haproxy-command",
+				"--config", "fixtures/config.yml",
+				"--deployment-name", "haproxy-from-flag",
+				"--gorouter-ip", "10.0.0.99",
+			}, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(hplugin.DeploymentName).Should(Equal("haproxy-from-flag"))
+			Ω(hplugin.GoRouterIPs).Should(ConsistOf("10.0.0.99"))
+		})
+
+		It("should prefer environment variables over the config file", func() {
+			os.Setenv("OMG_VM_TYPE", "large")
+			defer os.Setenv("OMG_VM_TYPE", "")
+			_, err := hplugin.GetProduct([]string{
+				"haproxy-command",
+				"--config", "fixtures/config.yml",
+			}, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(hplugin.VMType).Should(Equal("large"))
+		})
+
+		It("should read the config file from OMG_CONFIG", func() {
+			os.Setenv("OMG_CONFIG", "fixtures/config.yml")
+			defer os.Setenv("OMG_CONFIG", "")
+			_, err := hplugin.GetProduct([]string{"haproxy-command"}, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(hplugin.DeploymentName).Should(Equal("haproxy-from-config"))
+		})
+
+		It("should return an error for an unknown key", func() {
+			_, err := hplugin.GetProduct([]string{
+				"haproxy-command",
+				"--config", "fixtures/config-unknown-key.yml",
+			}, []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("not-a-flag")))
+		})
+
+		It("should return an error when the config file can not be read", func() {
+			_, err := hplugin.GetProduct([]string{
+				"haproxy-command",
+				"--config", "fixtures/does-not-exist.yml",
+			}, []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When a cloud config is given", func() {
+		var cloudConfig []byte
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			cloudConfig, _ = ioutil.ReadFile("fixtures/cloud-config.yml")
+		})
+
+		getProduct := func(overrides ...string) error {
+			args := []string{
+				"haproxy-command",
+				"--network-name", "net1",
+				"--vm-type", "small",
+				"--gorouter-ip", "10.0.0.20",
+				"--cert-filepath", "fixtures/pem1.pem",
+			}
+			args = append(args, overrides...)
+			_, err := hplugin.GetProduct(args, cloudConfig, nil)
+			return err
+		}
+
+		It("should accept flags that match the cloud config", func() {
+			Ω(getProduct("--az", "z1", "--az", "z2", "--haproxy-ip", "10.0.0.15", "--haproxy-ip", "10.0.1.10", "--haproxy-ip", "10.0.0.50")).Should(Succeed())
+		})
+
+		It("should reject an unknown vm type with a suggestion", func() {
+			Ω(getProduct("--az", "z1", "--haproxy-ip", "10.0.0.15", "--vm-type", "smal")).Should(MatchError(ContainSubstring("did you mean 'small'")))
+		})
+
+		It("should reject an unknown az with a suggestion", func() {
+			Ω(getProduct("--az", "z3", "--haproxy-ip", "10.0.0.15")).Should(MatchError(ContainSubstring("did you mean")))
+		})
+
+		It("should reject an unknown network with a suggestion", func() {
+			Ω(getProduct("--az", "z1", "--haproxy-ip", "10.0.0.15", "--network-name", "nett1")).Should(MatchError(ContainSubstring("did you mean 'net1'")))
+		})
+
+		It("should not suggest a name that is not close", func() {
+			err := getProduct("--az", "z1", "--haproxy-ip", "10.0.0.15", "--vm-type", "gigantic")
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).ShouldNot(ContainSubstring("did you mean"))
+		})
+
+		It("should reject a haproxy ip outside of the static ranges", func() {
+			Ω(getProduct("--az", "z1", "--haproxy-ip", "10.0.0.20")).Should(MatchError(ContainSubstring("not in a static range")))
+		})
+
+		It("should reject a haproxy ip in a static range of another az", func() {
+			Ω(getProduct("--az", "z1", "--haproxy-ip", "10.0.1.10")).Should(MatchError(ContainSubstring("not in a static range")))
+		})
+
+		Context("when no haproxy ip is given", func() {
+			It("should allocate the first free static ips in the az", func() {
+				Ω(getProduct("--az", "z1", "--haproxy-instances", "3", "--gorouter-ip", "10.0.0.11")).Should(Succeed())
+				Ω(hplugin.HaProxyIPs).Should(Equal([]string{"10.0.0.10", "10.0.0.12", "10.0.0.13"}), "gorouter ips should be skipped")
+			})
+
+			It("should spread the allocated ips across the azs", func() {
+				Ω(getProduct("--az", "z1", "--az", "z2", "--haproxy-instances", "3", "--gorouter-ip", "10.0.0.10")).Should(Succeed())
+				Ω(hplugin.HaProxyIPs).Should(Equal([]string{"10.0.0.11", "10.0.1.10", "10.0.0.12"}))
+			})
+
+			It("should fill up from the other azs when one runs out of ips", func() {
+				Ω(getProduct("--az", "z1", "--az", "z2", "--haproxy-instances", "21")).Should(Succeed())
+				Ω(hplugin.HaProxyIPs).Should(HaveLen(21))
+				Ω(hplugin.HaProxyIPs).Should(ContainElement("10.0.0.50"))
+				Ω(hplugin.HaProxyIPs).Should(ContainElement("10.0.1.19"))
+			})
+
+			It("should only allocate from subnets in the given azs", func() {
+				Ω(getProduct("--az", "z2", "--haproxy-instances", "2")).Should(Succeed())
+				Ω(hplugin.HaProxyIPs).Should(Equal([]string{"10.0.1.10", "10.0.1.11"}))
+			})
+
+			It("should allocate a single ip by default", func() {
+				Ω(getProduct("--az", "z1")).Should(Succeed())
+				Ω(hplugin.HaProxyIPs).Should(Equal([]string{"10.0.0.10"}))
+			})
+
+			It("should return an error when there are not enough free ips", func() {
+				Ω(getProduct("--az", "z2", "--haproxy-instances", "11")).Should(MatchError(ContainSubstring("only found 10 of 11")))
+			})
+
+			It("should return an error when there is no cloud config", func() {
+				cloudConfig = []byte{}
+				Ω(getProduct("--az", "z1")).Should(HaveOccurred())
+			})
+		})
+
+		It("should return an error when the instance count does not match the given ips", func() {
+			Ω(getProduct("--az", "z1", "--haproxy-ip", "10.0.0.15", "--haproxy-instances", "2")).Should(MatchError(ContainSubstring("haproxy-instances")))
+		})
+
+		It("should skip validation when no cloud config is given", func() {
+			cloudConfig = []byte{}
+			Ω(getProduct("--az", "z9", "--haproxy-ip", "10.9.9.9")).Should(Succeed())
+		})
+	})
+
+	Context("When a tls profile is passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--gorouter-ip", "10.0.0.20")
+		})
+
+		It("should use the intermediate profile by default", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.SslCiphers).Should(HavePrefix("ECDHE-ECDSA-AES128-GCM-SHA256:"))
+			Ω(ha.SslCiphers).ShouldNot(ContainSubstring("RC4"))
+			Ω(ha.DefaultDhParam).Should(Equal(2048))
+		})
+
+		It("should set the ciphers and dh param of a named profile", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--tls-profile", "legacy"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.SslCiphers).Should(ContainSubstring("DES-CBC3-SHA"))
+			Ω(ha.DefaultDhParam).Should(Equal(1024))
+		})
+
+		It("should use the given ciphers and dh param with the custom profile", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--tls-profile", "custom",
+				"--ssl-ciphers", "ECDHE-RSA-AES128-GCM-SHA256:kEDH+AESGCM:HIGH:!aNULL:!MD5:@STRENGTH",
+				"--dh-param", "4096",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.SslCiphers).Should(Equal("ECDHE-RSA-AES128-GCM-SHA256:kEDH+AESGCM:HIGH:!aNULL:!MD5:@STRENGTH"))
+			Ω(ha.DefaultDhParam).Should(Equal(4096))
+		})
+
+		It("should default the dh param of the custom profile", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--tls-profile", "custom", "--ssl-ciphers", "HIGH"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).DefaultDhParam).Should(Equal(2048))
+		})
+
+		It("should return an error for an unknown cipher", func() {
+			_, err := hplugin.GetProduct(append(args, "--tls-profile", "custom", "--ssl-ciphers", "ECDHE-RSA-AES128-GCM-SHA256:NOT-A-CIPHER"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("NOT-A-CIPHER")))
+		})
+
+		It("should return an error for a dh param size haproxy does not take", func() {
+			for _, dhParam := range []string{"7", "-1", "3000"} {
+				_, err := hplugin.GetProduct(append(args, "--tls-profile", "custom", "--ssl-ciphers", "HIGH", "--dh-param", dhParam), []byte{}, nil)
+				Ω(err).Should(MatchError(ContainSubstring("dh-param")), dhParam)
+			}
+		})
+
+		It("should return an error for ciphers separated by whitespace", func() {
+			for _, ciphers := range []string{"ECDHE-RSA-AES128-GCM-SHA256 AES128-SHA", "HIGH:\t!aNULL"} {
+				_, err := hplugin.GetProduct(append(args, "--tls-profile", "custom", "--ssl-ciphers", ciphers), []byte{}, nil)
+				Ω(err).Should(MatchError(ContainSubstring("whitespace")), ciphers)
+			}
+		})
+
+		It("should return an error for the custom profile without ciphers", func() {
+			_, err := hplugin.GetProduct(append(args, "--tls-profile", "custom"), []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return an error when ciphers are given with a named profile", func() {
+			_, err := hplugin.GetProduct(append(args, "--ssl-ciphers", "HIGH"), []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return an error when a dh param is given with a named profile", func() {
+			_, err := hplugin.GetProduct(append(args, "--tls-profile", "modern", "--dh-param", "4096"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("dh-param")))
+		})
+
+		It("should return an error for an unknown profile", func() {
+			_, err := hplugin.GetProduct(append(args, "--tls-profile", "paranoid"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("modern")))
+		})
+	})
+
+	Context("When headers are passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--gorouter-ip", "10.0.0.20")
+		})
+
+		getHeaders := func(manifestBytes []byte) (map[string]string, map[string]string) {
+			ha := getHaProxyProperties(manifestBytes)
+			return ha.Headers, ha.RspHeaders
+		}
+
+		It("should render request and response headers from flags", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--request-header", "X-Forwarded-Proto: https",
+				"--response-header", "Strict-Transport-Security: max-age=31536000; includeSubDomains",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			request, response := getHeaders(manifestBytes)
+			Ω(request).Should(Equal(map[string]string{"X-Forwarded-Proto": "https"}))
+			Ω(response).Should(Equal(map[string]string{"Strict-Transport-Security": "max-age=31536000; includeSubDomains"}))
+		})
+
+		It("should render headers from a headers file with flags taking precedence", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--headers-file", "fixtures/headers.yml",
+				"--request-header", "X-Request-Source: flag",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			request, response := getHeaders(manifestBytes)
+			Ω(request).Should(HaveKeyWithValue("X-Forwarded-Proto", "https"))
+			Ω(request).Should(HaveKeyWithValue("X-Request-Source", "flag"))
+			Ω(response).Should(HaveKeyWithValue("X-Frame-Options", "DENY"))
+		})
+
+		It("should escape haproxy delimiters", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--headers-file", "fixtures/headers.yml"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			_, response := getHeaders(manifestBytes)
+			Ω(response).Should(HaveKeyWithValue("X-Edge-Note", `\#1 edge`))
+		})
+
+		It("should escape tabs in header values", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--response-header", "X-Tabbed: a\tb"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			_, response := getHeaders(manifestBytes)
+			Ω(response).Should(HaveKeyWithValue("X-Tabbed", `a\tb`))
+		})
+
+		It("should escape haproxy delimiters in header names", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--request-header", "X#Id: 1", "--request-header", "X'Quote: 2"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			request, _ := getHeaders(manifestBytes)
+			Ω(request).Should(HaveKeyWithValue(`X\#Id`, "1"))
+			Ω(request).Should(HaveKeyWithValue(`X\'Quote`, "2"))
+		})
+
+		It("should not render headers when none are given", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			request, response := getHeaders(manifestBytes)
+			Ω(request).Should(BeEmpty())
+			Ω(response).Should(BeEmpty())
+		})
+
+		It("should return an error for an invalid header name", func() {
+			for _, header := range []string{"X Bad: value", "X(Bad): value", ": value", "no-colon"} {
+				_, err := hplugin.GetProduct(append(args, "--request-header", header), []byte{}, nil)
+				Ω(err).Should(HaveOccurred(), header)
+			}
+		})
+
+		It("should return an error for a header value with a control character", func() {
+			_, err := hplugin.GetProduct(append(args, "--response-header", "X-Bad: a\nb"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("control character")))
+		})
+	})
+
+	Context("When https redirect flags are passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--gorouter-ip", "10.0.0.20")
+		})
+
+		It("should redirect all http requests", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--https-redirect-all"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).HttpsRedirectAll).Should(BeTrue())
+		})
+
+		It("should redirect the given domains", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--https-redirect-domain", "apps.example.com",
+				"--https-redirect-domain", "system.example.com",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.HttpsRedirectDomains).Should(ConsistOf("apps.example.com", "system.example.com"))
+			Ω(ha.HttpsRedirectAll).Should(BeZero())
+		})
+
+		It("should disable http", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--disable-http"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).DisableHttp).Should(BeTrue())
+		})
+
+		It("should leave http settings unset by default", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.HttpsRedirectAll).Should(BeZero())
+			Ω(ha.HttpsRedirectDomains).Should(BeZero())
+			Ω(ha.DisableHttp).Should(BeZero())
+		})
+
+		It("should return an error when redirecting with http disabled", func() {
+			_, err := hplugin.GetProduct(append(args, "--https-redirect-all", "--disable-http"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("disable-http")))
+			_, err = hplugin.GetProduct(append(args, "--https-redirect-domain", "apps.example.com", "--disable-http"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("disable-http")))
+		})
+
+		It("should return an error when redirecting all and selected domains", func() {
+			_, err := hplugin.GetProduct(append(args, "--https-redirect-all", "--https-redirect-domain", "apps.example.com"), []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When timeout flags are passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--gorouter-ip", "10.0.0.20")
+		})
+
+		It("should leave the release default timeouts in place", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.ClientTimeout).Should(BeZero())
+			Ω(ha.WebsocketTimeout).Should(BeZero())
+		})
+
+		It("should set the timeouts of a named profile", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--timeout-profile", "websocket"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.ClientTimeout).Should(Equal(60))
+			Ω(ha.ServerTimeout).Should(Equal(60))
+			Ω(ha.ConnectTimeout).Should(Equal(5))
+			Ω(ha.KeepaliveTimeout).Should(Equal(5))
+			Ω(ha.QueueTimeout).Should(Equal(30))
+			Ω(ha.RequestTimeout).Should(Equal(30))
+			Ω(ha.WebsocketTimeout).Should(Equal(86400))
+		})
+
+		It("should let individual timeouts override the profile", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--timeout-profile", "long-poll",
+				"--server-timeout", "600",
+				"--client-timeout", "600",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.ServerTimeout).Should(Equal(600))
+			Ω(ha.ClientTimeout).Should(Equal(600))
+			Ω(ha.RequestTimeout).Should(Equal(300))
+		})
+
+		It("should render the release defaults alongside an individual timeout", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--connect-timeout", "10"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.ConnectTimeout).Should(Equal(10))
+			Ω(ha.ServerTimeout).Should(Equal(30))
+		})
+
+		It("should return an error when the websocket timeout is less than the server timeout", func() {
+			_, err := hplugin.GetProduct(append(args, "--server-timeout", "7200"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("websocket-timeout")))
+		})
+
+		It("should return an error for inconsistent timeouts", func() {
+			for _, timeout := range [][]string{
+				{"--connect-timeout", "60"},
+				{"--keepalive-timeout", "60"},
+				{"--request-timeout", "60"},
+				{"--queue-timeout", "-1"},
+			} {
+				_, err := hplugin.GetProduct(append(args, timeout...), []byte{}, nil)
+				Ω(err).Should(HaveOccurred(), strings.Join(timeout, " "))
+			}
+		})
+
+		It("should return an error for an unknown profile", func() {
+			_, err := hplugin.GetProduct(append(args, "--timeout-profile", "forever"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("long-poll")))
+		})
+	})
+
+	Context("When proxy protocol flags are passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--gorouter-ip", "10.0.0.20")
+		})
+
+		It("should accept the proxy protocol", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--accept-proxy", "--disable-http"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).AcceptProxy).Should(BeTrue())
+		})
+
+		It("should return an error when accept-proxy is given with http on port 80", func() {
+			_, err := hplugin.GetProduct(append(args, "--accept-proxy"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("disable-http")))
+		})
+
+		It("should set the gorouter port", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--gorouter-port", "8080"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).BackendPort).Should(Equal(8080))
+		})
+
+		It("should leave proxy settings unset by default", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.AcceptProxy).Should(BeZero())
+			Ω(ha.BackendPort).Should(BeZero())
+		})
+
+		It("should return an error for an out of range gorouter port", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-port", "70000"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("gorouter-port")))
+		})
+	})
+
+	Context("When compress types are passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--gorouter-ip", "10.0.0.20")
+		})
+
+		It("should join the compress types with spaces", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--compress-type", "Text/HTML",
+				"--compress-type", "application/json",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).CompressTypes).Should(Equal("text/html application/json"))
+		})
+
+		It("should expand the text preset without duplicates", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--compress-type", "text",
+				"--compress-type", "text/html",
+				"--compress-type", "application/wasm",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			types := strings.Split(getHaProxyProperties(manifestBytes).CompressTypes, " ")
+			Ω(types).Should(ContainElement("text/css"))
+			Ω(types).Should(ContainElement("application/json"))
+			Ω(types[len(types)-1]).Should(Equal("application/wasm"))
+			Ω(types).Should(HaveLen(10))
+		})
+
+		It("should not compress by default", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).CompressTypes).Should(BeEmpty())
+		})
+
+		It("should return an error for an invalid mime type", func() {
+			for _, t := range []string{"html", "text/html; charset=utf-8", "text/", "text/html/x"} {
+				_, err := hplugin.GetProduct(append(args, "--compress-type", t), []byte{}, nil)
+				Ω(err).Should(HaveOccurred(), t)
+			}
+		})
+	})
+
+	Context("When gorouter hostnames are passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith()
+		})
+
+		It("should render hostnames as backends along with the resolvers", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--gorouter-ip", "router.service.cf.internal",
+				"--gorouter-ip", "10.0.0.20",
+				"--dns-resolver", "10.0.0.2",
+				"--dns-resolver", "10.0.0.3",
+				"--dns-hold", "30s",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.BackendServers).Should(ConsistOf("router.service.cf.internal", "10.0.0.20"))
+			Ω(ha.Resolvers).Should(HaveLen(2))
+			Ω(ha.Resolvers[0]).Should(HaveKeyWithValue("dns0", "10.0.0.2"))
+			Ω(ha.Resolvers[1]).Should(HaveKeyWithValue("dns1", "10.0.0.3"))
+			Ω(ha.DnsHold).Should(Equal("30s"))
+		})
+
+		It("should not need a resolver for ips", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			ha := getHaProxyProperties(manifestBytes)
+			Ω(ha.Resolvers).Should(BeZero())
+			Ω(ha.DnsHold).Should(BeZero())
+		})
+
+		It("should return an error for a hostname without a resolver", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "router.service.cf.internal"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("dns-resolver")))
+		})
+
+		It("should return an error for a backend that is neither an ip nor a hostname", func() {
+			for _, server := range []string{"router_1.internal", "10.0.0.256", "10.0.0.256."} {
+				_, err := hplugin.GetProduct(append(args, "--gorouter-ip", server, "--dns-resolver", "10.0.0.2"), []byte{}, nil)
+				Ω(err).Should(MatchError(ContainSubstring("neither an ip nor a hostname")), server)
+			}
+		})
+
+		It("should accept hostnames with numeric labels before the last", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "0.router.10.internal", "--dns-resolver", "10.0.0.2"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should return an error for an invalid resolver", func() {
+			for _, resolver := range []string{"dns.internal", "10.0.0.2:53", "10.0.0.2:5353", "[::1]:53", "::1", "fd00::53"} {
+				_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20", "--dns-resolver", resolver), []byte{}, nil)
+				Ω(err).Should(HaveOccurred(), resolver)
+			}
+		})
+
+		It("should return an error for an invalid dns hold", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20", "--dns-hold", "ten seconds"), []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("When a cf manifest is passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith()
+		})
+
+		It("should use the gorouter static ips as backend servers", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--cf-manifest", "fixtures/cf-manifest.yml"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).BackendServers).Should(ConsistOf("10.0.0.20", "10.0.0.21"))
+		})
+
+		It("should use the static ips of every gorouter instance group", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--cf-manifest", "fixtures/cf-manifest-multi-az.yml"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getHaProxyProperties(manifestBytes).BackendServers).Should(ConsistOf("10.0.0.20", "10.0.0.21", "10.0.1.20", "10.0.1.21"))
+		})
+
+		It("should return an error when there is no gorouter instance group", func() {
+			_, err := hplugin.GetProduct(append(args, "--cf-manifest", "fixtures/cf-manifest-no-router.yml"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("gorouter")))
+		})
+
+		It("should return an error when the gorouters are on another network", func() {
+			args[4] = "net2"
+			_, err := hplugin.GetProduct(append(args, "--cf-manifest", "fixtures/cf-manifest.yml"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("net2")))
+		})
+
+		It("should return an error when gorouter ips are also given", func() {
+			_, err := hplugin.GetProduct(append(args, "--cf-manifest", "fixtures/cf-manifest.yml", "--gorouter-ip", "10.0.0.20"), []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return an error when neither gorouter ips nor a cf manifest are given", func() {
+			_, err := hplugin.GetProduct(args, []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return an error when the cf manifest can not be read", func() {
+			_, err := hplugin.GetProduct(append(args, "--cf-manifest", "fixtures/does-not-exist.yml"), []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return the parse error when the cf manifest is not valid yaml", func() {
+			_, err := hplugin.GetProduct(append(args, "--cf-manifest", "fixtures/cf-manifest-invalid.yml"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("cant parse cf manifest")))
+		})
+	})
+
+	Context("When a gorouter link is passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--release-tarball", "fixtures/haproxy-release.tgz")
+		})
+
+		It("should consume the link and leave the backend servers to it", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--gorouter-link", "gorouter", "--gorouter-link-deployment", "cf"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			job := manifest.GetInstanceGroupByName(DefaultInstanceGroupName).GetJobByName(DefaultJobName)
+			Ω(job.Consumes).Should(HaveKeyWithValue("http_backend", map[interface{}]interface{}{
+				"from":       "gorouter",
+				"deployment": "cf",
+			}))
+			Ω(getHaProxyProperties(manifestBytes).BackendServers).Should(BeEmpty())
+		})
+
+		It("should leave the deployment out when the link is in this deployment", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--gorouter-link", "gorouter"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			job := manifest.GetInstanceGroupByName(DefaultInstanceGroupName).GetJobByName(DefaultJobName)
+			Ω(job.Consumes).Should(HaveKeyWithValue("http_backend", map[interface{}]interface{}{
+				"from": "gorouter",
+			}))
+		})
+
+		It("should not consume any link when gorouter ips are given", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			Ω(manifest.GetInstanceGroupByName(DefaultInstanceGroupName).GetJobByName(DefaultJobName).Consumes).Should(BeEmpty())
+		})
+
+		It("should return an error when gorouter ips are also given", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-link", "gorouter", "--gorouter-ip", "10.0.0.20"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("gorouter-link")))
+		})
+
+		It("should return an error when a cf manifest is also given", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-link", "gorouter", "--cf-manifest", "fixtures/cf-manifest.yml"), []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return an error when the release does not consume the link", func() {
+			_, err := hplugin.GetProduct(append(args[:len(args)-2], "--gorouter-link", "gorouter"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("does not consume a http_backend link")))
+		})
+
+		It("should return an error when the release's job spec is unknown", func() {
+			_, err := hplugin.GetProduct(append(args[:len(args)-2],
+				"--haproxy-release-ver", "dev",
+				"--haproxy-release-url", "file:///tmp/haproxy-dev.tgz",
+				"--haproxy-release-sha", "abc123",
+				"--gorouter-link", "gorouter",
+			), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("release-tarball")))
+		})
+
+		It("should return an error when a link deployment is given without a link", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20", "--gorouter-link-deployment", "cf"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("gorouter-link-deployment")))
+		})
+	})
+
+	Context("When a haproxy release version is passed", func() {
+		var args []string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--gorouter-ip", "10.0.0.20")
+		})
+
+		It("should take the url and sha from the catalog", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--haproxy-release-ver", "8.0.9"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			release := enaml.NewDeploymentManifest(manifestBytes).Releases[0]
+			Ω(release.Version).Should(Equal("8.0.9"))
+			Ω(release.URL).Should(Equal(DefaultReleaseURL))
+			Ω(release.SHA1).Should(Equal(DefaultReleaseSHA))
+		})
+
+		It("should prefer a given url and sha over the catalog's", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--haproxy-release-url", "https://mirror.internal/haproxy-8.0.9.tgz",
+				"--haproxy-release-sha", "abc123",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			release := enaml.NewDeploymentManifest(manifestBytes).Releases[0]
+			Ω(release.URL).Should(Equal("https://mirror.internal/haproxy-8.0.9.tgz"))
+			Ω(release.SHA1).Should(Equal("abc123"))
+		})
+
+		It("should return an error for a version outside the catalog", func() {
+			_, err := hplugin.GetProduct(append(args, "--haproxy-release-ver", "latest"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("8.0.9")))
+		})
+
+		It("should accept a version outside the catalog with its url and sha", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args,
+				"--haproxy-release-ver", "dev",
+				"--haproxy-release-url", "file:///tmp/haproxy-dev.tgz",
+				"--haproxy-release-sha", "abc123",
+			), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			release := enaml.NewDeploymentManifest(manifestBytes).Releases[0]
+			Ω(release.Version).Should(Equal("dev"))
+			Ω(release.URL).Should(Equal("file:///tmp/haproxy-dev.tgz"))
+		})
+
+		It("should have a generated job spec for every catalog release", func() {
+			_, ok := haproxy.JobSpecs[DefaultReleaseVersion]
+			Ω(ok).Should(BeTrue())
+			Ω(haproxy.JobSpecs[DefaultReleaseVersion].Properties).Should(ContainElement("ha_proxy.backend_servers"))
+		})
+	})
+
+	Context("When a release tarball is passed", func() {
+		var args []string
+		var controlSHA string
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			args = argsWith("--release-tarball", "fixtures/haproxy-release.tgz")
+			b, err := ioutil.ReadFile("fixtures/haproxy-release.tgz")
+			Ω(err).ShouldNot(HaveOccurred())
+			controlSHA = fmt.Sprintf("%x", sha1.Sum(b))
+		})
+
+		It("should fill the release from the tarball", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			tarball, _ := filepath.Abs("fixtures/haproxy-release.tgz")
+			Ω(manifest.Releases[0].Name).Should(Equal("haproxy"))
+			Ω(manifest.Releases[0].Version).Should(Equal("8.0.9+dev.1"))
+			Ω(manifest.Releases[0].SHA1).Should(Equal(controlSHA))
+			Ω(manifest.Releases[0].URL).Should(Equal("file://" + tarball))
+			Ω(manifest.GetInstanceGroupByName(DefaultInstanceGroupName).GetJobByName(DefaultJobName).Release).Should(Equal("haproxy"))
+		})
+
+		It("should accept a matching sha", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20", "--haproxy-release-sha", controlSHA), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should accept a matching sha in upper case", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20", "--haproxy-release-sha", strings.ToUpper(controlSHA)), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should accept a matching version", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20", "--haproxy-release-ver", "8.0.9+dev.1"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should return an error when the given version does not match", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20", "--haproxy-release-ver", "8.0.9"), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring("8.0.9+dev.1")))
+		})
+
+		It("should return an error when the given sha does not match", func() {
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20", "--haproxy-release-sha", DefaultReleaseSHA), []byte{}, nil)
+			Ω(err).Should(MatchError(ContainSubstring(controlSHA)))
+		})
+
+		It("should check the flags against the job spec in the tarball", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--gorouter-link", "gorouter"), []byte{}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			Ω(manifest.GetInstanceGroupByName(DefaultInstanceGroupName).GetJobByName(DefaultJobName).Consumes).Should(HaveKey("http_backend"))
+		})
+
+		It("should return an error when the tarball is not a release", func() {
+			args[len(args)-1] = "fixtures/pem1.pem"
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20"), []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return an error when the tarball can not be read", func() {
+			args[len(args)-1] = "fixtures/does-not-exist.tgz"
+			_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20"), []byte{}, nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		Context("and its haproxy job has no tls properties", func() {
+			BeforeEach(func() {
+				args[len(args)-1] = "fixtures/haproxy-release-no-tls.tgz"
+			})
+
+			It("should leave the tls properties to the release with the default tls-profile", func() {
+				manifestBytes, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20"), []byte{}, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				ha := getHaProxyProperties(manifestBytes)
+				Ω(ha.SslCiphers).Should(BeEmpty())
+				Ω(ha.DefaultDhParam).Should(BeZero())
+			})
+
+			It("should return an error naming the flag for a tls-profile the release can not take", func() {
+				_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20", "--tls-profile", "modern"), []byte{}, nil)
+				Ω(err).Should(MatchError(ContainSubstring("--tls-profile or --dh-param")))
+			})
+
+			It("should return an error for custom ciphers", func() {
+				_, err := hplugin.GetProduct(append(args, "--gorouter-ip", "10.0.0.20", "--tls-profile", "custom", "--ssl-ciphers", "ECDHE-RSA-AES128-GCM-SHA256"), []byte{}, nil)
+				Ω(err).Should(MatchError(ContainSubstring("does not support")))
+			})
+		})
+	})
+
+	Context("When keepalived flags are passed", func() {
+		var controlVIP = "10.0.0.100"
+		var controlHaProxyIPs = []string{
+			"10.0.0.10",
+			"10.0.0.11",
+		}
+		var args []string
+		var store *fakeStore
+
+		BeforeEach(func() {
+			hplugin = &Plugin{Version: "0.0"}
+			store = &fakeStore{creds: map[string]string{}}
+			args = argsWith(
+				"--gorouter-ip", "10.0.0.20",
+				"--haproxy-ip", controlHaProxyIPs[1],
+				"--keepalived-vip", controlVIP,
+				"--keepalived-virtual-router-id", "42",
+				"--keepalived-interface", "eth1",
+			)
+		})
+
+		getKeepalivedProperties := func(manifestBytes []byte) *Keepalived {
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			job := manifest.GetInstanceGroupByName(DefaultInstanceGroupName).GetJobByName(DefaultKeepalivedJobName)
+			Ω(job).ShouldNot(BeNil(), "keepalived should be colocated with haproxy")
+			propBytes, err := yaml.Marshal(job.Properties)
+			Ω(err).ShouldNot(HaveOccurred())
+			props := new(KeepalivedJob)
+			Ω(yaml.Unmarshal(propBytes, props)).Should(Succeed())
+			return props.Keepalived
+		}
+
+		It("should add the keepalived release", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			Ω(manifest.Releases).Should(HaveLen(2))
+			Ω(manifest.Releases[1].Name).Should(Equal("keepalived"))
+		})
+
+		It("should configure the keepalived job from the flags", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			props := getKeepalivedProperties(manifestBytes)
+			Ω(props.VirtualIP).Should(Equal(controlVIP))
+			Ω(props.VirtualRouterID).Should(Equal(42))
+			Ω(props.Interface).Should(Equal("eth1"))
+		})
+
+		It("should give each instance its own descending priority", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			priorities := getKeepalivedProperties(manifestBytes).Priorities
+			Ω(priorities).Should(HaveLen(len(controlHaProxyIPs)))
+			Ω(priorities[controlHaProxyIPs[0]]).Should(BeNumerically(">", priorities[controlHaProxyIPs[1]]))
+		})
+
+		It("should generate and store a password when none exists", func() {
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(store.creds["keepalived-password"]).ShouldNot(BeEmpty())
+			Ω(getKeepalivedProperties(manifestBytes).Password).Should(Equal(store.creds["keepalived-password"]))
+		})
+
+		It("should reuse the password from the credential store", func() {
+			store.creds["keepalived-password"] = "s3cr3t"
+			manifestBytes, err := hplugin.GetProduct(args, []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(getKeepalivedProperties(manifestBytes).Password).Should(Equal("s3cr3t"))
+		})
+
+		It("should return an error instead of replacing the password when the store can not be read", func() {
+			store.creds["keepalived-password"] = "s3cr3t"
+			store.getErr = errors.New("connection refused")
+			_, err := hplugin.GetProduct(args, []byte{}, store)
+			Ω(err).Should(MatchError(ContainSubstring("connection refused")))
+			Ω(store.creds["keepalived-password"]).Should(Equal("s3cr3t"))
+		})
+
+		It("should return an error when the virtual router id is out of range", func() {
+			_, err := hplugin.GetProduct(append(args, "--keepalived-virtual-router-id", "256"), []byte{}, store)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return an error when the vip is also a haproxy ip", func() {
+			_, err := hplugin.GetProduct(append(args, "--keepalived-vip", controlHaProxyIPs[0]), []byte{}, store)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("should return an error when the vip is not an ip", func() {
+			for _, vip := range []string{"haproxy.internal", "10.0.0.256"} {
+				_, err := hplugin.GetProduct(append(args, "--keepalived-vip", vip), []byte{}, store)
+				Ω(err).Should(MatchError(ContainSubstring("is not an ip")), vip)
+			}
+		})
+
+		It("should return an error with a single haproxy instance", func() {
+			_, err := hplugin.GetProduct(argsWith("--gorouter-ip", "10.0.0.20", "--keepalived-vip", controlVIP), []byte{}, store)
+			Ω(err).Should(MatchError(ContainSubstring("at least 2 haproxy instances")))
+		})
+
+		It("should fill the keepalived release from a tarball", func() {
+			manifestBytes, err := hplugin.GetProduct(append(args, "--keepalived-release-tarball", "fixtures/keepalived-release.tgz"), []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			tarball, _ := filepath.Abs("fixtures/keepalived-release.tgz")
+			Ω(manifest.Releases[1].Name).Should(Equal("keepalived"))
+			Ω(manifest.Releases[1].Version).Should(Equal("0.0.1+dev.1"))
+			Ω(manifest.Releases[1].URL).Should(Equal("file://" + tarball))
+			Ω(manifest.Releases[1].SHA1).ShouldNot(BeEmpty())
+		})
+
+		It("should return an error for a property the keepalived job does not declare", func() {
+			_, err := hplugin.GetProduct(append(args, "--keepalived-release-tarball", "fixtures/keepalived-release-no-priorities.tgz"), []byte{}, store)
+			Ω(err).Should(MatchError(ContainSubstring("keepalived.priorities")))
+		})
+
+		It("should return an error when the tarball has no keepalived job", func() {
+			_, err := hplugin.GetProduct(append(args, "--keepalived-release-tarball", "fixtures/haproxy-release.tgz"), []byte{}, store)
+			Ω(err).Should(MatchError(ContainSubstring("has no keepalived job")))
+		})
+
+		It("should return an error for a keepalived tarball without a vip", func() {
+			_, err := hplugin.GetProduct(argsWith("--gorouter-ip", "10.0.0.20", "--keepalived-release-tarball", "fixtures/keepalived-release.tgz"), []byte{}, store)
+			Ω(err).Should(MatchError(ContainSubstring("keepalived-vip")))
+		})
+
+		It("should not colocate keepalived when no vip is given", func() {
+			manifestBytes, err := hplugin.GetProduct(args[:len(args)-6], []byte{}, store)
+			Ω(err).ShouldNot(HaveOccurred())
+			manifest := enaml.NewDeploymentManifest(manifestBytes)
+			Ω(manifest.Releases).Should(HaveLen(1))
+			Ω(manifest.GetInstanceGroupByName(DefaultInstanceGroupName).GetJobByName(DefaultKeepalivedJobName)).Should(BeNil())
+		})
+	})
+})
+
+// baseArgs are the flags every haproxy deployment in these specs needs.
+// Contexts add the flags they exercise with argsWith.
+var baseArgs = []string{
+	"haproxy-command",
+	"--az", "z1",
+	"--network-name", "net1",
+	"--vm-type", "small",
+	"--haproxy-ip", "10.0.0.10",
+	"--cert-filepath", "fixtures/pem1.pem",
+}
+
+// argsWith returns a copy of baseArgs followed by extra.
+func argsWith(extra ...string) []string {
+	return append(append([]string{}, baseArgs...), extra...)
+}
+
+// getHaProxyProperties returns the ha_proxy properties of the haproxy job in
+// a generated manifest.
+func getHaProxyProperties(manifestBytes []byte) *haproxy.HaProxy {
+	manifest := enaml.NewDeploymentManifest(manifestBytes)
+	propBytes, err := yaml.Marshal(manifest.GetInstanceGroupByName(DefaultInstanceGroupName).GetJobByName(DefaultJobName).Properties)
+	Ω(err).ShouldNot(HaveOccurred())
+	props := new(haproxy.HaproxyJob)
+	Ω(yaml.Unmarshal(propBytes, props)).Should(Succeed())
+	return props.HaProxy
+}
+
+// writeCert writes a self-signed cert for hours.example.com expiring at
+// notAfter to a temp dir, and returns its path.
+func writeCert(notAfter time.Time) string {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	Ω(err).ShouldNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hours.example.com"},
+		NotBefore:    notAfter.AddDate(0, 0, -30),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Ω(err).ShouldNot(HaveOccurred())
+	dir, err := ioutil.TempDir("", "cert-report")
+	Ω(err).ShouldNot(HaveOccurred())
+	pempath := filepath.Join(dir, "cert.pem")
+	Ω(ioutil.WriteFile(pempath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).Should(Succeed())
+	return pempath
+}
+
+type fakeStore struct {
+	creds  map[string]string
+	getErr error
+}
+
+func (s *fakeStore) Get(key string) (string, error) {
+	if s.getErr != nil {
+		return "", s.getErr
+	}
+	return s.creds[key], nil
+}
+
+func (s *fakeStore) Put(key, value string) error {
+	s.creds[key] = value
+	return nil
+}
@@ -0,0 +1,163 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/enaml-ops/haproxy-plugin/haproxy/enaml-gen/haproxy"
+	"github.com/xchapter7x/lo"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// haproxyRelease is a haproxy-boshrelease version the plugin can deploy.
+// Its job spec is generated into enaml-gen/haproxy.
+type haproxyRelease struct {
+	Version string
+	URL     string
+	SHA1    string
+}
+
+// haproxyReleases is the catalog haproxy-release-ver picks from, newest
+// first.
+var haproxyReleases = []haproxyRelease{
+	haproxyRelease{
+		Version: DefaultReleaseVersion,
+		URL:     DefaultReleaseURL,
+		SHA1:    DefaultReleaseSHA,
+	},
+}
+
+// propertyFlags are the flags that set each haproxy job property, so a
+// property the release does not support can be reported as a flag.
+var propertyFlags = map[string][]string{
+	"accept_proxy":           {"accept-proxy"},
+	"backend_port":           {"gorouter-port"},
+	"backend_servers":        {"gorouter-ip", "cf-manifest"},
+	"client_timeout":         {"timeout-profile", "client-timeout"},
+	"compress_types":         {"compress-type"},
+	"connect_timeout":        {"timeout-profile", "connect-timeout"},
+	"default_dh_param":       {"tls-profile", "dh-param"},
+	"disable_http":           {"disable-http"},
+	"dns_hold":               {"dns-hold"},
+	"headers":                {"request-header", "headers-file"},
+	"https_redirect_all":     {"https-redirect-all"},
+	"https_redirect_domains": {"https-redirect-domain"},
+	"internal_only_domains":  {"internal-only-domain"},
+	"keepalive_timeout":      {"timeout-profile", "keepalive-timeout"},
+	"queue_timeout":          {"timeout-profile", "queue-timeout"},
+	"request_timeout":        {"timeout-profile", "request-timeout"},
+	"resolvers":              {"dns-resolver"},
+	"routed_backend_servers": {"routed-backend"},
+	"rsp_headers":            {"response-header", "headers-file"},
+	"server_timeout":         {"timeout-profile", "server-timeout"},
+	"ssl_ciphers":            {"tls-profile", "ssl-ciphers"},
+	"ssl_pem":                {"cert-filepath", "cert-from-store"},
+	"stats_enable":           {"stats-enable"},
+	"stats_password":         {"stats-enable", "stats-password"},
+	"stats_uri":              {"stats-enable", "stats-uri"},
+	"stats_user":             {"stats-enable", "stats-user"},
+	"syslog_server":          {"syslog-url"},
+	"tcp":                    {"tcp-mapping"},
+	"trusted_domain_cidrs":   {"trusted-domain-cidr"},
+	"trusted_stats_cidrs":    {"trusted-stats-cidr"},
+	"websocket_timeout":      {"timeout-profile", "websocket-timeout"},
+}
+
+// selectRelease fills in the url and sha of the catalog release picked by
+// haproxy-release-ver. A version outside the catalog, such as a dev build,
+// is accepted when its url and sha are given, but its job spec is unknown
+// unless it came from a release-tarball.
+func (p *Plugin) selectRelease() error {
+	if p.HaproxyReleaseVer == "" {
+		p.HaproxyReleaseVer = DefaultReleaseVersion
+	}
+	for _, r := range haproxyReleases {
+		if r.Version != p.HaproxyReleaseVer {
+			continue
+		}
+		if p.HaproxyReleaseURL == "" {
+			p.HaproxyReleaseURL = r.URL
+		}
+		if p.HaproxyReleaseSHA == "" {
+			p.HaproxyReleaseSHA = r.SHA1
+		}
+		if p.jobSpec != nil {
+			return nil
+		}
+		spec, ok := haproxy.JobSpecs[r.Version]
+		if !ok {
+			return fmt.Errorf("no job spec generated for haproxy release %s", r.Version)
+		}
+		p.jobSpec = &spec
+		return nil
+	}
+	if p.HaproxyReleaseURL == "" || p.HaproxyReleaseSHA == "" {
+		return fmt.Errorf("haproxy-release-ver '%s' is not in the release catalog, expected one of %s or give its haproxy-release-url and haproxy-release-sha", p.HaproxyReleaseVer, strings.Join(releaseVersions(), ", "))
+	}
+	if p.jobSpec != nil {
+		return nil
+	}
+	lo.G.Warningf("haproxy-release-ver '%s' is not in the release catalog, flags are not checked against what it supports", p.HaproxyReleaseVer)
+	return nil
+}
+
+// validateRelease rejects flags that set properties the selected release's
+// haproxy job does not have.
+func (p *Plugin) validateRelease() error {
+	if p.jobSpec == nil {
+		return nil
+	}
+	supported := make(map[string]bool)
+	for _, property := range p.jobSpec.Properties {
+		supported[property] = true
+	}
+	b, err := yaml.Marshal(p.newHaProxy())
+	if err != nil {
+		return err
+	}
+	properties := make(map[string]interface{})
+	if err = yaml.Unmarshal(b, &properties); err != nil {
+		return err
+	}
+	var keys []string
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !supported["ha_proxy."+key] {
+			return fmt.Errorf("haproxy release %s does not support %s (ha_proxy.%s)", p.HaproxyReleaseVer, flagList(propertyFlags[key]), key)
+		}
+	}
+	return nil
+}
+
+// supportsProperty reports whether the selected release's haproxy job has
+// the property, assuming it does when the job spec is unknown.
+func (p *Plugin) supportsProperty(property string) bool {
+	if p.jobSpec == nil {
+		return true
+	}
+	for _, supported := range p.jobSpec.Properties {
+		if supported == property {
+			return true
+		}
+	}
+	return false
+}
+
+func flagList(flags []string) string {
+	if len(flags) == 0 {
+		return "the flags given"
+	}
+	return "--" + strings.Join(flags, " or --")
+}
+
+func releaseVersions() []string {
+	var versions []string
+	for _, r := range haproxyReleases {
+		versions = append(versions, r.Version)
+	}
+	return versions
+}
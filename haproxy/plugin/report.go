@@ -0,0 +1,150 @@
+package haproxy_plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/enaml-ops/pluginlib/pcli"
+	"github.com/enaml-ops/pluginlib/pluginutil"
+)
+
+// CertReportCommand is the first argument that switches the plugin binary
+// into cert report mode instead of running as an omg product.
+const CertReportCommand = "cert-report"
+
+// CertReport is a single certificate found in a pem bundle.
+type CertReport struct {
+	Bundle        string    `json:"bundle"`
+	Subject       string    `json:"subject"`
+	SANs          []string  `json:"sans"`
+	Issuer        string    `json:"issuer"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+}
+
+type certReportConfig struct {
+	PEMFiles         []string `omg:"cert-filepath"`
+	Format           string   `omg:"format"`
+	ExpiryWindowDays int      `omg:"expiry-window-days"`
+}
+
+// GetCertReport prints the subject, SANs, issuer and expiry of every cert
+// in every bundle given with --cert-filepath. It returns an error when any
+// cert expires within the expiry window, so callers can exit non-zero.
+func (p *Plugin) GetCertReport(args []string, w io.Writer) error {
+	cfg := new(certReportConfig)
+	c := pluginutil.NewContext(args, pluginutil.ToCliFlagArray(p.GetCertReportFlags()))
+	if err := pcli.UnmarshalFlags(cfg, c); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reports, err := newCertReports(cfg.PEMFiles, now)
+	if err != nil {
+		return err
+	}
+
+	switch cfg.Format {
+	case "json":
+		err = writeCertReportJSON(w, reports)
+	case "table":
+		err = writeCertReportTable(w, reports)
+	default:
+		err = fmt.Errorf("unknown format %q, expected table or json", cfg.Format)
+	}
+	if err != nil {
+		return err
+	}
+
+	var expiring []string
+	deadline := now.AddDate(0, 0, cfg.ExpiryWindowDays)
+	for _, r := range reports {
+		if r.NotAfter.Before(deadline) {
+			expiring = append(expiring, fmt.Sprintf("%s (%s)", r.Subject, r.Bundle))
+		}
+	}
+	if len(expiring) > 0 {
+		return fmt.Errorf("certificates expiring within %d days: %s", cfg.ExpiryWindowDays, strings.Join(expiring, ", "))
+	}
+	return nil
+}
+
+func newCertReports(pemFiles []string, now time.Time) ([]CertReport, error) {
+	var reports []CertReport
+	for _, pempath := range pemFiles {
+		bundle, err := ioutil.ReadFile(pempath)
+		if err != nil {
+			return nil, fmt.Errorf("cant read pem file @ '%v': %v", pempath, err)
+		}
+		certBlocks, _ := splitPEMBundle(bundle)
+		certs, err := parseCertificates(certBlocks)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pem file @ '%v': %v", pempath, err)
+		}
+		for _, cert := range certs {
+			reports = append(reports, CertReport{
+				Bundle:        pempath,
+				Subject:       cert.Subject.CommonName,
+				SANs:          cert.DNSNames,
+				Issuer:        cert.Issuer.CommonName,
+				NotAfter:      cert.NotAfter,
+				DaysRemaining: daysRemaining(cert.NotAfter, now),
+			})
+		}
+	}
+	return reports, nil
+}
+
+// daysRemaining counts the whole days left before notAfter, rounding down so
+// a cert that expired hours ago shows -1 rather than 0.
+func daysRemaining(notAfter, now time.Time) int {
+	return int(math.Floor(notAfter.Sub(now).Hours() / 24))
+}
+
+func writeCertReportJSON(w io.Writer, reports []CertReport) error {
+	b, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+func writeCertReportTable(w io.Writer, reports []CertReport) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "BUNDLE\tSUBJECT\tSANS\tISSUER\tNOT AFTER\tDAYS REMAINING")
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n",
+			r.Bundle, r.Subject, strings.Join(r.SANs, ","), r.Issuer, r.NotAfter.Format("2006-01-02"), r.DaysRemaining)
+	}
+	return tw.Flush()
+}
+
+// GetCertReportFlags returns the CLI flags accepted in cert report mode.
+func (p *Plugin) GetCertReportFlags() []pcli.Flag {
+	return []pcli.Flag{
+		pcli.Flag{
+			FlagType: pcli.StringSliceFlag,
+			Name:     "cert-filepath",
+			Usage:    "the path to your pem file containing entire chain (give multiple flags to report on multiple pems)",
+		},
+		pcli.Flag{
+			FlagType: pcli.StringFlag,
+			Name:     "format",
+			Value:    "table",
+			Usage:    "the output format of the report (table or json)",
+		},
+		pcli.Flag{
+			FlagType: pcli.IntFlag,
+			Name:     "expiry-window-days",
+			Value:    defaultExpiryWindowDays,
+			Usage:    "exit non-zero when any cert expires within this many days",
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/enaml-ops/haproxy-plugin/haproxy/enaml-gen/haproxy"
+)
+
+// parseRoutedBackend parses a routed backend given as
+// <prefix>:<port>:<router-ip>[:<router-ip>...].
+func parseRoutedBackend(s string) (string, haproxy.RoutedBackendServer, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 3 {
+		return "", haproxy.RoutedBackendServer{}, fmt.Errorf("routed-backend '%s' should be prefix:port:router-ip[:router-ip...]", s)
+	}
+	prefix := parts[0]
+	if !strings.HasPrefix(prefix, "/") || prefix == "/" {
+		return "", haproxy.RoutedBackendServer{}, fmt.Errorf("routed-backend prefix '%s' should start with / and not be the root path", prefix)
+	}
+	if strings.ContainsAny(prefix, " \t?#") {
+		return "", haproxy.RoutedBackendServer{}, fmt.Errorf("routed-backend prefix '%s' should not contain whitespace, ? or #", prefix)
+	}
+	port, err := parsePort(parts[1])
+	if err != nil {
+		return "", haproxy.RoutedBackendServer{}, fmt.Errorf("routed-backend '%s' has an invalid port: %v", s, err)
+	}
+	for _, ip := range parts[2:] {
+		if ip == "" {
+			return "", haproxy.RoutedBackendServer{}, fmt.Errorf("routed-backend '%s' has an empty router ip", s)
+		}
+	}
+	return prefix, haproxy.RoutedBackendServer{Port: port, Servers: parts[2:]}, nil
+}
+
+// newRoutedBackendServers maps each url prefix to its router port and ips.
+// haproxy matches prefixes with path_beg, so a prefix that begins another
+// one (e.g. /foo and /foobar) would make the routing order dependent and is
+// rejected.
+func (p *Plugin) newRoutedBackendServers() (map[string]haproxy.RoutedBackendServer, error) {
+	routed := make(map[string]haproxy.RoutedBackendServer)
+	for _, s := range p.RoutedBackends {
+		prefix, backend, err := parseRoutedBackend(s)
+		if err != nil {
+			return nil, err
+		}
+		for existing := range routed {
+			if strings.HasPrefix(prefix, existing) || strings.HasPrefix(existing, prefix) {
+				return nil, fmt.Errorf("routed-backend prefix '%s' overlaps with '%s'", prefix, existing)
+			}
+		}
+		routed[prefix] = backend
+	}
+	return routed, nil
+}
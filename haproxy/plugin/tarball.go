@@ -0,0 +1,158 @@
+package haproxy_plugin
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/enaml-ops/haproxy-plugin/haproxy/enaml-gen/haproxy"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type releaseManifest struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+}
+
+type releaseJobSpec struct {
+	Properties map[string]interface{} `yaml:"properties"`
+	Consumes   []struct {
+		Name string `yaml:"name"`
+	} `yaml:"consumes"`
+}
+
+// releaseTarball is what the plugin reads from a local release tarball.
+type releaseTarball struct {
+	Name    string
+	Version string
+	SHA1    string
+	URL     string
+	Spec    *releaseJobSpec
+}
+
+// readReleaseTarball reads the name, version and sha of the release tarball
+// given with flagName, and the job spec of its job.
+func readReleaseTarball(flagName, tarballPath, job string) (*releaseTarball, error) {
+	f, err := os.Open(tarballPath)
+	if err != nil {
+		return nil, fmt.Errorf("cant read %s @ '%v': %v", flagName, tarballPath, err)
+	}
+	defer f.Close()
+	hash := sha1.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return nil, fmt.Errorf("cant read %s @ '%v': %v", flagName, tarballPath, err)
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	b, err := readTarEntry(f, "release.MF")
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s @ '%v': %v", flagName, tarballPath, err)
+	}
+	manifest := new(releaseManifest)
+	if err = yaml.Unmarshal(b, manifest); err != nil {
+		return nil, fmt.Errorf("invalid release.MF in %s @ '%v': %v", flagName, tarballPath, err)
+	}
+	if manifest.Name == "" || manifest.Version == "" {
+		return nil, fmt.Errorf("release.MF in %s @ '%v' is missing the release name or version", flagName, tarballPath)
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	jobTarball, err := readTarEntry(f, path.Join("jobs", job+".tgz"))
+	if err != nil {
+		return nil, fmt.Errorf("%s @ '%v' has no %s job: %v", flagName, tarballPath, job, err)
+	}
+	if b, err = readTarEntry(bytes.NewReader(jobTarball), "job.MF"); err != nil {
+		return nil, fmt.Errorf("invalid %s job in %s @ '%v': %v", job, flagName, tarballPath, err)
+	}
+	spec := new(releaseJobSpec)
+	if err = yaml.Unmarshal(b, spec); err != nil {
+		return nil, fmt.Errorf("invalid %s job spec in %s @ '%v': %v", job, flagName, tarballPath, err)
+	}
+
+	abs, err := filepath.Abs(tarballPath)
+	if err != nil {
+		return nil, err
+	}
+	return &releaseTarball{
+		Name:    manifest.Name,
+		Version: manifest.Version,
+		SHA1:    fmt.Sprintf("%x", hash.Sum(nil)),
+		URL:     "file://" + filepath.ToSlash(abs),
+		Spec:    spec,
+	}, nil
+}
+
+// loadReleaseTarball takes the release name, version and sha from a local
+// release tarball, with a file url pointing the director at it, so nothing
+// is downloaded from bosh.io. The flags are checked against the job spec in
+// the tarball, which also covers builds that are not in the catalog.
+func (p *Plugin) loadReleaseTarball() error {
+	if p.ReleaseTarball == "" {
+		return nil
+	}
+	release, err := readReleaseTarball("release-tarball", p.ReleaseTarball, DefaultJobName)
+	if err != nil {
+		return err
+	}
+	if p.HaproxyReleaseSHA != "" && !strings.EqualFold(p.HaproxyReleaseSHA, release.SHA1) {
+		return fmt.Errorf("haproxy-release-sha %s does not match the sha %s of release-tarball @ '%v'", p.HaproxyReleaseSHA, release.SHA1, p.ReleaseTarball)
+	}
+	if p.HaproxyReleaseVer != "" && p.HaproxyReleaseVer != release.Version {
+		return fmt.Errorf("haproxy-release-ver %s does not match the version %s of release-tarball @ '%v'", p.HaproxyReleaseVer, release.Version, p.ReleaseTarball)
+	}
+	p.haproxyReleaseName = release.Name
+	p.HaproxyReleaseVer = release.Version
+	p.HaproxyReleaseSHA = release.SHA1
+	if p.HaproxyReleaseURL == "" {
+		p.HaproxyReleaseURL = release.URL
+	}
+	p.jobSpec = release.Spec.jobSpec()
+	return nil
+}
+
+func (spec *releaseJobSpec) jobSpec() *haproxy.JobSpec {
+	js := new(haproxy.JobSpec)
+	for property := range spec.Properties {
+		js.Properties = append(js.Properties, property)
+	}
+	sort.Strings(js.Properties)
+	for _, link := range spec.Consumes {
+		js.Consumes = append(js.Consumes, link.Name)
+	}
+	return js
+}
+
+// readTarEntry returns the contents of the named file in a gzipped tarball.
+func readTarEntry(r io.Reader, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Clean(hdr.Name) == name {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/enaml-ops/haproxy-plugin/haproxy/enaml-gen/haproxy"
+)
+
+// reservedPorts are the ports haproxy already listens on for http traffic.
+// The stats UI also takes statsPort when it is enabled.
+var reservedPorts = []int{80, 443, 4443}
+
+// tcpNamePattern matches the mapping names that are safe to use in the
+// frontend and backend names the release derives from them.
+var tcpNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// parseTCPMapping parses a single ha_proxy.tcp entry, proxying a port
+// straight through to a set of backend servers, given as
+// <name>:<port>:<backend-port>:<backend-server>[:<backend-server>...].
+func parseTCPMapping(s string) (haproxy.Tcp, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 4 {
+		return haproxy.Tcp{}, fmt.Errorf("tcp-mapping '%s' should be name:port:backend-port:backend-server[:backend-server...]", s)
+	}
+	m := haproxy.Tcp{
+		Name:           parts[0],
+		BackendServers: parts[3:],
+	}
+	if m.Name == "" {
+		return haproxy.Tcp{}, fmt.Errorf("tcp-mapping '%s' is missing a name", s)
+	}
+	if !tcpNamePattern.MatchString(m.Name) {
+		return haproxy.Tcp{}, fmt.Errorf("tcp-mapping name '%s' should only contain letters, digits, _, . and -", m.Name)
+	}
+	var err error
+	if m.Port, err = parsePort(parts[1]); err != nil {
+		return haproxy.Tcp{}, fmt.Errorf("tcp-mapping '%s' has an invalid port: %v", s, err)
+	}
+	if m.BackendPort, err = parsePort(parts[2]); err != nil {
+		return haproxy.Tcp{}, fmt.Errorf("tcp-mapping '%s' has an invalid backend port: %v", s, err)
+	}
+	for _, server := range m.BackendServers {
+		if server == "" {
+			return haproxy.Tcp{}, fmt.Errorf("tcp-mapping '%s' has an empty backend server", s)
+		}
+	}
+	return m, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%d is out of range", port)
+	}
+	return port, nil
+}
+
+func (p *Plugin) newTCPMappings() ([]haproxy.Tcp, error) {
+	var mappings []haproxy.Tcp
+	used := make(map[int]string)
+	for _, port := range reservedPorts {
+		used[port] = "http"
+	}
+	if p.StatsEnable {
+		used[statsPort] = "stats"
+	}
+	for _, s := range p.TCPMappings {
+		m, err := parseTCPMapping(s)
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range mappings {
+			if existing.Name == m.Name {
+				return nil, fmt.Errorf("tcp-mapping name '%s' is given more than once", m.Name)
+			}
+		}
+		if owner, ok := used[m.Port]; ok {
+			return nil, fmt.Errorf("tcp-mapping '%s' port %d is already used by %s", m.Name, m.Port, owner)
+		}
+		used[m.Port] = m.Name
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
@@ -0,0 +1,121 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const timeoutProfileDefault = "default"
+
+// timeouts are the haproxy timeouts, in seconds.
+type timeouts struct {
+	Client    int
+	Server    int
+	Connect   int
+	Keepalive int
+	Queue     int
+	Request   int
+	Websocket int
+}
+
+var timeoutProfiles = map[string]timeouts{
+	// the release defaults
+	timeoutProfileDefault: timeouts{
+		Client:    30,
+		Server:    30,
+		Connect:   5,
+		Keepalive: 1,
+		Queue:     30,
+		Request:   30,
+		Websocket: 3600,
+	},
+	// long lived websocket connections with periodic pings
+	"websocket": timeouts{
+		Client:    60,
+		Server:    60,
+		Connect:   5,
+		Keepalive: 5,
+		Queue:     30,
+		Request:   30,
+		Websocket: 86400,
+	},
+	// long polling requests and slow uploads
+	"long-poll": timeouts{
+		Client:    300,
+		Server:    300,
+		Connect:   5,
+		Keepalive: 5,
+		Queue:     60,
+		Request:   300,
+		Websocket: 3600,
+	},
+}
+
+// newTimeouts returns the timeouts of the chosen profile with any timeouts
+// given individually taking precedence. It returns nil when neither a
+// profile nor any timeout was given, leaving the release defaults in place.
+func (p *Plugin) newTimeouts() (*timeouts, error) {
+	profile, ok := timeoutProfiles[p.TimeoutProfile]
+	if !ok {
+		return nil, fmt.Errorf("unknown timeout-profile '%s', expected one of %s", p.TimeoutProfile, strings.Join(timeoutProfileNames(), ", "))
+	}
+	t := profile
+	overrides := []struct {
+		name  string
+		value int
+		dest  *int
+	}{
+		{"client-timeout", p.ClientTimeout, &t.Client},
+		{"server-timeout", p.ServerTimeout, &t.Server},
+		{"connect-timeout", p.ConnectTimeout, &t.Connect},
+		{"keepalive-timeout", p.KeepaliveTimeout, &t.Keepalive},
+		{"queue-timeout", p.QueueTimeout, &t.Queue},
+		{"request-timeout", p.RequestTimeout, &t.Request},
+		{"websocket-timeout", p.WebsocketTimeout, &t.Websocket},
+	}
+	overridden := false
+	for _, o := range overrides {
+		if o.value < 0 {
+			return nil, fmt.Errorf("%s must be a positive number of seconds, got %d", o.name, o.value)
+		}
+		if o.value > 0 {
+			*o.dest = o.value
+			overridden = true
+		}
+	}
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	if p.TimeoutProfile == timeoutProfileDefault && !overridden {
+		return nil, nil
+	}
+	return &t, nil
+}
+
+// validate rejects timeouts that would cut connections off earlier than
+// another timeout intends.
+func (t timeouts) validate() error {
+	if t.Websocket < t.Server || t.Websocket < t.Client {
+		return fmt.Errorf("websocket-timeout (%ds) must be at least the client-timeout (%ds) and server-timeout (%ds)", t.Websocket, t.Client, t.Server)
+	}
+	if t.Connect > t.Server {
+		return fmt.Errorf("connect-timeout (%ds) must not be more than the server-timeout (%ds)", t.Connect, t.Server)
+	}
+	if t.Keepalive > t.Client {
+		return fmt.Errorf("keepalive-timeout (%ds) must not be more than the client-timeout (%ds)", t.Keepalive, t.Client)
+	}
+	if t.Request > t.Client {
+		return fmt.Errorf("request-timeout (%ds) must not be more than the client-timeout (%ds)", t.Request, t.Client)
+	}
+	return nil
+}
+
+func timeoutProfileNames() []string {
+	var names []string
+	for name := range timeoutProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
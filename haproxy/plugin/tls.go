@@ -0,0 +1,153 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xchapter7x/lo"
+)
+
+const (
+	tlsProfileModern       = "modern"
+	tlsProfileIntermediate = "intermediate"
+	tlsProfileLegacy       = "legacy"
+	tlsProfileCustom       = "custom"
+)
+
+// tlsProfile is a named set of ciphers and dh param size, following
+// Mozilla's server side TLS guidance.
+type tlsProfile struct {
+	Ciphers string
+	DhParam int
+}
+
+var tlsProfiles = map[string]tlsProfile{
+	tlsProfileModern: tlsProfile{
+		Ciphers: "ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-CHACHA20-POLY1305:ECDHE-RSA-CHACHA20-POLY1305:ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256",
+		DhParam: 2048,
+	},
+	tlsProfileIntermediate: tlsProfile{
+		Ciphers: "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-CHACHA20-POLY1305:ECDHE-RSA-CHACHA20-POLY1305:DHE-RSA-AES128-GCM-SHA256:DHE-RSA-AES256-GCM-SHA384",
+		DhParam: 2048,
+	},
+	tlsProfileLegacy: tlsProfile{
+		Ciphers: "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384:DHE-RSA-AES128-GCM-SHA256:DHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-AES128-SHA256:ECDHE-RSA-AES128-SHA256:ECDHE-ECDSA-AES128-SHA:ECDHE-RSA-AES128-SHA:ECDHE-ECDSA-AES256-SHA384:ECDHE-RSA-AES256-SHA384:ECDHE-ECDSA-AES256-SHA:ECDHE-RSA-AES256-SHA:DHE-RSA-AES128-SHA256:DHE-RSA-AES256-SHA256:AES128-GCM-SHA256:AES256-GCM-SHA384:AES128-SHA256:AES256-SHA256:AES128-SHA:AES256-SHA:DES-CBC3-SHA",
+		DhParam: 1024,
+	},
+}
+
+// dhParamSizes are the dh param sizes, in bits, a custom profile may use.
+var dhParamSizes = []int{1024, 2048, 4096, 8192}
+
+// knownCiphers are the OpenSSL cipher suite names and cipher list keywords
+// accepted in a custom cipher string.
+var knownCiphers = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Split(tlsProfiles[tlsProfileLegacy].Ciphers+":"+tlsProfiles[tlsProfileModern].Ciphers, ":") {
+		knownCiphers[name] = true
+	}
+	for _, name := range []string{
+		// suites not used by any profile
+		"ECDHE-RSA-RC4-SHA", "ECDHE-ECDSA-RC4-SHA", "RC4-SHA", "RC4-MD5",
+		"DHE-DSS-AES128-GCM-SHA256", "DHE-DSS-AES256-GCM-SHA384", "DHE-DSS-AES128-SHA256",
+		"DHE-DSS-AES256-SHA256", "DHE-DSS-AES128-SHA", "DHE-DSS-AES256-SHA",
+		"DHE-RSA-AES128-SHA", "DHE-RSA-AES256-SHA", "DHE-RSA-CHACHA20-POLY1305",
+		"ECDHE-RSA-DES-CBC3-SHA", "ECDHE-ECDSA-DES-CBC3-SHA", "EDH-RSA-DES-CBC3-SHA",
+		"AES128-CCM", "AES256-CCM", "ECDHE-ECDSA-AES128-CCM", "ECDHE-ECDSA-AES256-CCM",
+		// cipher list keywords
+		"ALL", "COMPLEMENTOFALL", "COMPLEMENTOFDEFAULT", "DEFAULT", "HIGH", "MEDIUM", "LOW",
+		"EXPORT", "eNULL", "NULL", "aNULL", "kRSA", "aRSA", "RSA", "kDHE", "kEDH", "DH",
+		"DHE", "EDH", "ADH", "kECDHE", "kEECDH", "ECDH", "ECDHE", "EECDH", "AECDH", "aDSS",
+		"DSS", "aECDSA", "ECDSA", "SSLv3", "TLSv1", "TLSv1.2", "AES", "AES128", "AES256",
+		"AESGCM", "AESCCM", "CHACHA20", "3DES", "DES", "RC4", "RC2", "IDEA", "SEED", "MD5",
+		"SHA1", "SHA", "SHA256", "SHA384", "PSK", "SRP", "CAMELLIA", "aGOST", "kGOST",
+	} {
+		knownCiphers[name] = true
+	}
+}
+
+// validateCiphers checks every cipher in an OpenSSL cipher string is known.
+// Entries may be prefixed with !, - or +, combined with +, or be an @
+// command such as @STRENGTH. The release writes the string unquoted into
+// the bind lines, so it can not contain whitespace.
+func validateCiphers(ciphers string) error {
+	if strings.TrimSpace(ciphers) == "" {
+		return fmt.Errorf("ssl-ciphers is required with the %s tls-profile", tlsProfileCustom)
+	}
+	if strings.IndexFunc(ciphers, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("ssl-ciphers '%s' should be separated with : and not contain whitespace", ciphers)
+	}
+	for _, entry := range strings.FieldsFunc(ciphers, func(r rune) bool { return r == ':' || r == ',' }) {
+		if strings.HasPrefix(entry, "@") {
+			continue
+		}
+		entry = strings.TrimLeft(entry, "!-+")
+		for _, name := range strings.Split(entry, "+") {
+			if !knownCiphers[name] {
+				return fmt.Errorf("unknown cipher '%s' in ssl-ciphers", name)
+			}
+		}
+	}
+	return nil
+}
+
+// newTLSProfile returns the ciphers and dh param for the chosen profile.
+func (p *Plugin) newTLSProfile() (tlsProfile, error) {
+	if p.TLSProfile == tlsProfileCustom {
+		if err := validateCiphers(p.SSLCiphers); err != nil {
+			return tlsProfile{}, err
+		}
+		dhParam := p.DhParam
+		if dhParam == 0 {
+			dhParam = defaultDhParam
+		}
+		if err := validateDhParam(dhParam); err != nil {
+			return tlsProfile{}, err
+		}
+		return tlsProfile{
+			Ciphers: p.SSLCiphers,
+			DhParam: dhParam,
+		}, nil
+	}
+	if p.SSLCiphers != "" {
+		return tlsProfile{}, fmt.Errorf("ssl-ciphers can only be given with the %s tls-profile", tlsProfileCustom)
+	}
+	if p.DhParam != 0 {
+		return tlsProfile{}, fmt.Errorf("dh-param can only be given with the %s tls-profile", tlsProfileCustom)
+	}
+	profile, ok := tlsProfiles[p.TLSProfile]
+	if !ok {
+		return tlsProfile{}, fmt.Errorf("unknown tls-profile '%s', expected one of %s", p.TLSProfile, strings.Join(tlsProfileNames(), ", "))
+	}
+	if p.TLSProfile == defaultTLSProfile && !(p.supportsProperty("ha_proxy.ssl_ciphers") && p.supportsProperty("ha_proxy.default_dh_param")) {
+		// older releases have no tls properties, leave them to the
+		// release's own defaults rather than failing on the default profile
+		lo.G.Infof("haproxy release %s does not support tls profiles, using its default ciphers", p.HaproxyReleaseVer)
+		return tlsProfile{}, nil
+	}
+	return profile, nil
+}
+
+func validateDhParam(dhParam int) error {
+	var sizes []string
+	for _, size := range dhParamSizes {
+		if dhParam == size {
+			return nil
+		}
+		sizes = append(sizes, strconv.Itoa(size))
+	}
+	return fmt.Errorf("dh-param %d should be one of %s", dhParam, strings.Join(sizes, ", "))
+}
+
+func tlsProfileNames() []string {
+	var names []string
+	for name := range tlsProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, tlsProfileCustom)
+}
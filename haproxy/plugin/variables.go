@@ -0,0 +1,103 @@
+package haproxy_plugin
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/enaml-ops/enaml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// variable is a BOSH variable definition that the director (or its config
+// server) generates, so the secret never appears in the manifest itself.
+type variable struct {
+	Name    string                 `yaml:"name"`
+	Type    string                 `yaml:"type"`
+	Options map[string]interface{} `yaml:"options,omitempty"`
+}
+
+type variablesManifest struct {
+	enaml.DeploymentManifest `yaml:",inline"`
+	Variables                []variable `yaml:"variables,omitempty"`
+}
+
+// variableNamePattern matches config server names, which may be absolute
+// paths such as /director/deployment/name.
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+func variableRef(name string) string {
+	return "((" + name + "))"
+}
+
+// loadVariableSecrets points the pems and passwords at BOSH variables
+// instead of reading them from disk or the credential store.
+func (p *Plugin) loadVariableSecrets() error {
+	if len(p.PEMFiles) > 0 || len(p.PEMStoreNames) > 0 {
+		return fmt.Errorf("cert-filepath and cert-from-store can not be used with use-bosh-variables")
+	}
+	certName := sslCertVariableName
+	if p.SSLCertVariable != "" {
+		if len(p.SSLCertDomains) > 0 {
+			return fmt.Errorf("ssl-cert-domain can not be used with ssl-cert-variable, the existing cert already has its domains")
+		}
+		if !variableNamePattern.MatchString(p.SSLCertVariable) {
+			return fmt.Errorf("ssl-cert-variable '%s' should only contain letters, digits, _, ., - and /", p.SSLCertVariable)
+		}
+		certName = p.SSLCertVariable
+	} else if len(p.SSLCertDomains) == 0 {
+		return fmt.Errorf("at least one ssl-cert-domain or an ssl-cert-variable is required with use-bosh-variables")
+	}
+	p.pems = []string{
+		variableRef(certName+".certificate") + "\n" + variableRef(certName+".private_key"),
+	}
+	p.keepalivedPassword = variableRef(keepalivedPasswordVariableName)
+	p.statsPassword = variableRef(statsPasswordVariableName)
+	return nil
+}
+
+// newVariables defines the variables the manifest references, leaving out
+// the cert when an existing one is referenced with ssl-cert-variable.
+func (p *Plugin) newVariables() []variable {
+	var vars []variable
+	if p.SSLCertVariable == "" {
+		vars = append(vars,
+			variable{
+				Name: sslCAVariableName,
+				Type: "certificate",
+				Options: map[string]interface{}{
+					"is_ca":       true,
+					"common_name": "haproxyCA",
+				},
+			},
+			variable{
+				Name: sslCertVariableName,
+				Type: "certificate",
+				Options: map[string]interface{}{
+					"ca":                sslCAVariableName,
+					"common_name":       p.SSLCertDomains[0],
+					"alternative_names": p.SSLCertDomains,
+				},
+			},
+		)
+	}
+	if p.StatsEnable && p.StatsPassword == "" {
+		vars = append(vars, variable{
+			Name: statsPasswordVariableName,
+			Type: "password",
+		})
+	}
+	if p.keepalivedEnabled() {
+		vars = append(vars, variable{
+			Name: keepalivedPasswordVariableName,
+			Type: "password",
+		})
+	}
+	return vars
+}
+
+func (p *Plugin) manifestWithVariables(dm *enaml.DeploymentManifest) ([]byte, error) {
+	return yaml.Marshal(&variablesManifest{
+		DeploymentManifest: *dm,
+		Variables:          p.newVariables(),
+	})
+}